@@ -0,0 +1,70 @@
+package cogito
+
+import (
+	"fmt"
+	"slices"
+	"time"
+	// The container image has no time zone database.
+	_ "time/tzdata"
+)
+
+// validate verifies the keys of qh.
+func (qh QuietHours) validate() error {
+	if qh.Start == "" || qh.End == "" {
+		return fmt.Errorf("missing keys: start, end")
+	}
+	start, err := parseClock(qh.Start)
+	if err != nil {
+		return fmt.Errorf("start: %s", err)
+	}
+	end, err := parseClock(qh.End)
+	if err != nil {
+		return fmt.Errorf("end: %s", err)
+	}
+	if start == end {
+		return fmt.Errorf("start and end must differ, have: %s", qh.Start)
+	}
+	if _, err := time.LoadLocation(qh.TimeZone); err != nil {
+		return fmt.Errorf("time_zone: %s", err)
+	}
+	return nil
+}
+
+// contains returns true if now is within qh. It assumes that qh has been validated.
+func (qh QuietHours) contains(now time.Time) bool {
+	loc, _ := time.LoadLocation(qh.TimeZone)
+	start, _ := parseClock(qh.Start)
+	end, _ := parseClock(qh.End)
+	local := now.In(loc)
+	minutes := local.Hour()*60 + local.Minute()
+	if start < end {
+		return start <= minutes && minutes < end
+	}
+	// The window spans midnight.
+	return minutes >= start || minutes < end
+}
+
+// parseClock returns the minutes since midnight of clock, in format HH:MM.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, have: %q", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quietHoursReason returns the reason not to send the chat message for state at time
+// now, if now is within one of quietHours and state is not allowed by it. Otherwise,
+// it returns the empty string.
+func quietHoursReason(quietHours []QuietHours, state BuildState, now time.Time) string {
+	for _, qh := range quietHours {
+		if qh.contains(now) && !slices.Contains(qh.AllowStates, state) {
+			tz := qh.TimeZone
+			if tz == "" {
+				tz = "UTC"
+			}
+			return fmt.Sprintf("chat_quiet_hours %s-%s %s", qh.Start, qh.End, tz)
+		}
+	}
+	return ""
+}
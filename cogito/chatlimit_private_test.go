@@ -0,0 +1,95 @@
+package cogito
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestQuietHoursContains(t *testing.T) {
+	type testCase struct {
+		name string
+		qh   QuietHours
+		now  time.Time
+		want bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.NilError(t, tc.qh.validate())
+		assert.Equal(t, tc.qh.contains(tc.now), tc.want)
+	}
+
+	utc := func(hour, minute int) time.Time {
+		return time.Date(2026, 1, 15, hour, minute, 0, 0, time.UTC)
+	}
+	night := QuietHours{Start: "22:00", End: "07:00"}
+	lunch := QuietHours{Start: "12:00", End: "13:30", TimeZone: "Europe/Zurich"}
+
+	testCases := []testCase{
+		{name: "spanning midnight, before midnight", qh: night, now: utc(23, 10), want: true},
+		{name: "spanning midnight, after midnight", qh: night, now: utc(3, 0), want: true},
+		{name: "spanning midnight, start included", qh: night, now: utc(22, 0), want: true},
+		{name: "spanning midnight, end excluded", qh: night, now: utc(7, 0), want: false},
+		{name: "spanning midnight, outside", qh: night, now: utc(15, 0), want: false},
+		// Zurich is UTC+1 in January.
+		{name: "time zone, inside", qh: lunch, now: utc(12, 15), want: true},
+		{name: "time zone, outside", qh: lunch, now: utc(12, 45), want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestQuietHoursValidateFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		qh      QuietHours
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Error(t, tc.qh.validate(), tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing end",
+			qh:      QuietHours{Start: "22:00"},
+			wantErr: "missing keys: start, end",
+		},
+		{
+			name:    "invalid start",
+			qh:      QuietHours{Start: "10pm", End: "07:00"},
+			wantErr: `start: want HH:MM, have: "10pm"`,
+		},
+		{
+			name:    "empty window",
+			qh:      QuietHours{Start: "07:00", End: "07:00"},
+			wantErr: "start and end must differ, have: 07:00",
+		},
+		{
+			name:    "unknown time zone",
+			qh:      QuietHours{Start: "22:00", End: "07:00", TimeZone: "Mars/Olympus"},
+			wantErr: "time_zone: unknown time zone Mars/Olympus",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestQuietHoursReason(t *testing.T) {
+	quietHours := []QuietHours{
+		{Start: "22:00", End: "07:00", AllowStates: []BuildState{StateError}},
+	}
+	night := time.Date(2026, 1, 15, 3, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, quietHoursReason(quietHours, StateFailure, night),
+		"chat_quiet_hours 22:00-07:00 UTC")
+	assert.Equal(t, quietHoursReason(quietHours, StateError, night), "")
+	assert.Equal(t, quietHoursReason(quietHours, StateFailure, day), "")
+}
@@ -1,14 +1,18 @@
 package cogito
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"time"
 )
 
 // Check implements the "check" step (the "check" executable).
-// For the Cogito resource, this is a no-op.
+// For the Cogito resource, this is a no-op, unless source.watch_branch is set: see
+// [watchVersions].
 //
 // From https://concourse-ci.org/implementing-resource-types.html#resource-check:
 //
@@ -33,7 +37,7 @@ func Check(log *slog.Logger, input []byte, out io.Writer, args []string) error {
 	// omit it from the _first_ request of the check step.
 
 	// Here a normal resource would fetch a list of the latest versions.
-	// In this resource, we do nothing.
+	// In this resource, we do nothing, unless in watch mode.
 
 	// Since there is no meaningful real version for this resource, we return always the
 	// same dummy version.
@@ -42,6 +46,13 @@ func Check(log *slog.Logger, input []byte, out io.Writer, args []string) error {
 	// For the time being we keep it as-is because this maintains the previous behavior.
 	// This will be investigated by PCI-2617.
 	versions := []Version{DummyVersion}
+	if request.Source.WatchBranch != "" {
+		versions, err = watchVersions(log, request.Source, request.Version)
+		if err != nil {
+			return fmt.Errorf("check: %s", err)
+		}
+	}
+
 	enc := json.NewEncoder(out)
 	if err := enc.Encode(versions); err != nil {
 		return fmt.Errorf("check: preparing output: %s", err)
@@ -50,3 +61,62 @@ func Check(log *slog.Logger, input []byte, out io.Writer, args []string) error {
 	log.Debug("success", "output.version", versions)
 	return nil
 }
+
+// watchVersions returns the versions for the HEAD of source.watch_branch: one per
+// (SHA, context, state), in chronological order, starting from current if still valid.
+//
+// The GitHub API reports only the latest state of each context, so this cannot be
+// a complete history: if a context changes state more than once between two checks,
+// only the last change becomes a version.
+func watchVersions(log *slog.Logger, source Source, current Version,
+) ([]Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	gh, err := newGhClient(ctx, log, source)
+	if err != nil {
+		return nil, err
+	}
+	sha, statuses, err := gh.CommitStatuses(ctx, source.WatchBranch,
+		source.WatchCheckRuns)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("watch", "branch", source.WatchBranch, "sha", sha,
+		"statuses", len(statuses))
+
+	if len(source.WatchContexts) > 0 {
+		statuses = slices.DeleteFunc(statuses, func(st ContextStatus) bool {
+			return !slices.Contains(source.WatchContexts, st.Context)
+		})
+	}
+	slices.SortStableFunc(statuses, func(a, b ContextStatus) int {
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	})
+
+	versions := make([]Version, 0, len(statuses))
+	for _, st := range statuses {
+		ver := Version{Ref: sha, Context: st.Context, State: st.State}
+		// A status and a check run can have the same name.
+		if !slices.Contains(versions, ver) {
+			versions = append(versions, ver)
+		}
+	}
+	if len(versions) == 0 {
+		return versions, nil
+	}
+
+	// A version emitted by put has also other fields (time, chat_time, repos): compare
+	// only the fields of a watch version.
+	if i := slices.IndexFunc(versions, func(ver Version) bool {
+		return ver.Ref == current.Ref && ver.Context == current.Context &&
+			ver.State == current.State
+	}); i >= 0 {
+		return versions[i:], nil
+	}
+	if current.Context == "" {
+		// First check, or watch_branch has just been added: no history to reproduce.
+		return versions[len(versions)-1:], nil
+	}
+	return versions, nil
+}
@@ -2,7 +2,11 @@ package cogito_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -54,6 +58,17 @@ func TestCheckSuccess(t *testing.T) {
 			},
 			wantOut: []cogito.Version{{Ref: "dummy"}},
 		},
+		{
+			name: "secret env variable not needed outside of watch mode",
+			request: cogito.CheckRequest{
+				Source: cogito.Source{
+					Owner:          "the-owner",
+					Repo:           "the-repo",
+					AccessTokenEnv: "COGITO_TEST_NON_EXISTING",
+				},
+			},
+			wantOut: []cogito.Version{{Ref: "dummy"}},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -147,3 +162,159 @@ func TestCheckInputFailure(t *testing.T) {
 
 	assert.Error(t, err, "check: parsing request: EOF")
 }
+
+// githubStatusServer returns a fake GitHub API server, replying to the combined
+// status and check runs requests for commit sha, with HEAD of branch "main" at sha.
+func githubStatusServer(t *testing.T, sha, statuses, checkRuns string,
+) *httptest.Server {
+	replies := map[string]string{
+		"/repos/the-owner/the-repo/commits/main/status":            statuses,
+		"/repos/the-owner/the-repo/commits/" + sha + "/status":     statuses,
+		"/repos/the-owner/the-repo/commits/" + sha + "/check-runs": checkRuns,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply, found := replies[r.URL.Path]
+		if !found || r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"message": "Not Found"}`)
+			return
+		}
+		fmt.Fprint(w, reply)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestCheckWatchSuccess(t *testing.T) {
+	type testCase struct {
+		name      string
+		contexts  []string
+		checkRuns bool
+		version   cogito.Version
+		wantOut   []cogito.Version
+	}
+
+	const sha = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	const statuses = `{"sha": "` + sha + `", "statuses": [
+  {"context": "unit", "state": "success", "updated_at": "2026-01-01T10:02:00Z"},
+  {"context": "lint", "state": "failure", "updated_at": "2026-01-01T10:01:00Z"}
+]}`
+	const checkRuns = `{"check_runs": [
+  {"name": "e2e", "status": "in_progress", "started_at": "2026-01-01T10:03:00Z"},
+  {"name": "lint", "status": "completed", "conclusion": "failure",
+   "completed_at": "2026-01-01T10:04:00Z"}
+]}`
+
+	test := func(t *testing.T, tc testCase) {
+		ts := githubStatusServer(t, sha, statuses, checkRuns)
+		source := cogito.Source{
+			Owner:          "the-owner",
+			Repo:           "the-repo",
+			AccessToken:    "the-token",
+			GhHostname:     strings.TrimPrefix(ts.URL, "http://"),
+			WatchBranch:    "main",
+			WatchContexts:  tc.contexts,
+			WatchCheckRuns: tc.checkRuns,
+		}
+		in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source, Version: tc.version})
+		var out bytes.Buffer
+
+		err := cogito.Check(testhelp.MakeTestLog(), in, &out, nil)
+
+		assert.NilError(t, err)
+		var have []cogito.Version
+		testhelp.FromJSON(t, out.Bytes(), &have)
+		assert.DeepEqual(t, have, tc.wantOut)
+	}
+
+	lint := cogito.Version{Ref: sha, Context: "lint", State: "failure"}
+	unit := cogito.Version{Ref: sha, Context: "unit", State: "success"}
+	e2e := cogito.Version{Ref: sha, Context: "e2e", State: "pending"}
+
+	testCases := []testCase{
+		{
+			name:    "first request: only the latest version",
+			wantOut: []cogito.Version{unit},
+		},
+		{
+			name:    "from the dummy version: only the latest version",
+			version: cogito.DummyVersion,
+			wantOut: []cogito.Version{unit},
+		},
+		{
+			name:    "current version still valid, in chronological order",
+			version: lint,
+			wantOut: []cogito.Version{lint, unit},
+		},
+		{
+			name: "current version emitted by put",
+			version: cogito.Version{Ref: sha, Context: "lint", State: "failure",
+				Time: "2026-01-01T10:01:00Z"},
+			wantOut: []cogito.Version{lint, unit},
+		},
+		{
+			name: "current version emitted by put, with chat time and repos",
+			version: cogito.Version{Ref: sha, Context: "unit", State: "success",
+				Time: "2026-01-01T10:02:00Z", ChatTime: "2026-01-01T10:02:00Z",
+				Repos: "the-owner/other-repo@" + sha + ":unit"},
+			wantOut: []cogito.Version{unit},
+		},
+		{
+			name: "current version not valid anymore: all versions",
+			version: cogito.Version{Ref: "0123456789abcdef0123456789abcdef01234567",
+				Context: "lint", State: "success"},
+			wantOut: []cogito.Version{lint, unit},
+		},
+		{
+			name:     "filtered by context",
+			contexts: []string{"lint"},
+			version:  lint,
+			wantOut:  []cogito.Version{lint},
+		},
+		{
+			name:     "no matching context",
+			contexts: []string{"banana"},
+			wantOut:  []cogito.Version{},
+		},
+		{
+			name:      "with check runs, same name and state as a status",
+			checkRuns: true,
+			version:   lint,
+			wantOut:   []cogito.Version{lint, unit, e2e},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestCheckWatchFailure(t *testing.T) {
+	ts := githubStatusServer(t, "dummySHA", "{}", "{}")
+	source := cogito.Source{
+		Owner:       "the-owner",
+		Repo:        "the-repo",
+		AccessToken: "the-token",
+		GhHostname:  strings.TrimPrefix(ts.URL, "http://"),
+		WatchBranch: "non-existing",
+	}
+	in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source})
+
+	err := cogito.Check(testhelp.MakeTestLog(), in, io.Discard, nil)
+
+	assert.Error(t, err, `check: github: GET /repos/the-owner/the-repo/commits/non-existing/status: 404 Not Found: {"message": "Not Found"}`)
+}
+
+func TestCheckWatchSecretEnvFailure(t *testing.T) {
+	source := cogito.Source{
+		Owner:          "the-owner",
+		Repo:           "the-repo",
+		AccessTokenEnv: "COGITO_TEST_NON_EXISTING",
+		WatchBranch:    "main",
+	}
+	in := testhelp.ToJSON(t, cogito.CheckRequest{Source: source})
+
+	err := cogito.Check(testhelp.MakeTestLog(), in, io.Discard, nil)
+
+	assert.ErrorContains(t, err, "source: access_token_env: environment variable COGITO_TEST_NON_EXISTING is not set or empty")
+}
@@ -0,0 +1,494 @@
+package cogito
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConcourseBuild is the information about the current build read from the Concourse
+// API, when source.concourse_token is set. See [concourseClient.fetchBuild].
+type ConcourseBuild struct {
+	StartTime time.Time
+	// Duration is the time elapsed from StartTime to when cogito ran.
+	Duration time.Duration
+	// CreatedBy is the user who triggered the build. Empty if the build has been
+	// triggered by Concourse itself.
+	CreatedBy string
+	// FailedStep is the name of the first step that failed (for example the name of a
+	// task). Empty if no step failed.
+	FailedStep string
+	// FailedStepType is the type of FailedStep, such as task, get or put.
+	FailedStepType string
+	// FailedStepLog is the tail of the output of FailedStep, with the ANSI escape
+	// sequences stripped. Empty unless source.chat_log_lines is set.
+	FailedStepLog []string
+}
+
+// concourseClient reads from the Concourse API.
+// The API is not officially documented; it is the same API used by the fly CLI and
+// by the web UI. See https://github.com/concourse/concourse/tree/master/atc/routes.go
+type concourseClient struct {
+	log        *slog.Logger
+	httpClient *http.Client
+	server     string        // The ATC URL, for example https://ci.example.org
+	token      string        // SENSITIVE
+	timeout    time.Duration // Bounds each of the methods reading from the API.
+	// idleTimeout bounds the wait for the next build event. Since cogito runs inside
+	// the build it is reading, the stream of events never ends by itself.
+	idleTimeout time.Duration
+	logLines    int // How many lines of the output of the failed step to keep.
+}
+
+const (
+	concourseTimeout     = 30 * time.Second
+	concourseIdleTimeout = 2 * time.Second
+	// How many builds of a job to read to find the previous one.
+	concourseBuildsLimit = 10
+)
+
+// newConcourseClient returns a concourseClient for source. If source.concourse_url is
+// not set, it defaults to the URL of the ATC running the build.
+func newConcourseClient(log *slog.Logger, source Source, env Environment,
+) concourseClient {
+	server := source.ConcourseURL
+	if server == "" {
+		server = env.AtcExternalUrl
+	}
+	return concourseClient{
+		log:         log,
+		httpClient:  &http.Client{},
+		server:      strings.TrimSuffix(server, "/"),
+		token:       source.ConcourseToken,
+		timeout:     concourseTimeout,
+		idleTimeout: concourseIdleTimeout,
+		logLines:    source.ChatLogLines,
+	}
+}
+
+// fetchBuild returns the [ConcourseBuild] of the build with the given id.
+func (cc concourseClient) fetchBuild(buildID string, now time.Time,
+) (ConcourseBuild, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cc.timeout)
+	defer cancel()
+
+	// API: GET /api/v1/builds/{id}
+	var build struct {
+		StartTime int64  `json:"start_time"` // Unix time.
+		CreatedBy string `json:"created_by"`
+	}
+	if err := cc.get(ctx, path.Join("builds", buildID), &build); err != nil {
+		return ConcourseBuild{}, err
+	}
+	info := ConcourseBuild{CreatedBy: build.CreatedBy}
+	if build.StartTime > 0 {
+		info.StartTime = time.Unix(build.StartTime, 0)
+		info.Duration = now.Sub(info.StartTime).Round(time.Second)
+	}
+
+	// API: GET /api/v1/builds/{id}/plan
+	var plan struct {
+		Plan json.RawMessage `json:"plan"`
+	}
+	if err := cc.get(ctx, path.Join("builds", buildID, "plan"), &plan); err != nil {
+		return ConcourseBuild{}, err
+	}
+	steps := make(map[string]planStep)
+	if err := collectPlanSteps(plan.Plan, steps); err != nil {
+		return ConcourseBuild{}, fmt.Errorf("concourse: build plan: %s", err)
+	}
+
+	var failedID string
+	// The output of each step, by plan id. We do not know in advance which step will
+	// fail, so we keep the tail of all of them.
+	logs := make(map[string]*logTail)
+	err := cc.events(ctx, buildID, func(ev buildEvent) bool {
+		// The events after the start of cogito come from this put step or from steps
+		// running in parallel to it: the history of the build has been read.
+		if ev.Data.Time > now.Unix() {
+			return false
+		}
+		if ev.Event == "log" && cc.logLines > 0 {
+			tail, found := logs[ev.Data.Origin.ID]
+			if !found {
+				tail = &logTail{max: cc.logLines}
+				logs[ev.Data.Origin.ID] = tail
+			}
+			tail.write(ev.Data.Payload)
+		}
+		if ev.failed() {
+			failedID = ev.Data.Origin.ID
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return ConcourseBuild{}, err
+	}
+	if failedID != "" {
+		step := steps[failedID]
+		info.FailedStep = step.name
+		info.FailedStepType = step.kind
+		if tail, found := logs[failedID]; found {
+			info.FailedStepLog = tail.lines()
+		}
+	}
+
+	return info, nil
+}
+
+// previousBuildState returns the state of the latest finished build of the job of env
+// preceding the current one, or the empty string if there is none.
+func (cc concourseClient) previousBuildState(env Environment) (BuildState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cc.timeout)
+	defer cancel()
+
+	current, builds, err := cc.jobBuilds(ctx, env)
+	if err != nil {
+		return "", err
+	}
+	for _, build := range builds {
+		if build.ID >= current {
+			continue
+		}
+		switch build.Status {
+		case "succeeded":
+			return StateSuccess, nil
+		case "failed":
+			return StateFailure, nil
+		case "errored":
+			return StateError, nil
+		case "aborted":
+			return StateAbort, nil
+		}
+	}
+	return "", nil
+}
+
+// lastChatTime returns the time of the latest chat message, sent after since by the
+// previous builds of the job of env, or the zero time if there is none. The time is read
+// from the versions emitted by the put steps, see [Version.ChatTime].
+func (cc concourseClient) lastChatTime(env Environment, since time.Time,
+) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cc.timeout)
+	defer cancel()
+
+	current, builds, err := cc.jobBuilds(ctx, env)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, build := range builds {
+		if build.ID >= current {
+			continue
+		}
+		// The following builds ended even earlier: none of them can have a message
+		// sent after since.
+		if build.EndTime != 0 && time.Unix(build.EndTime, 0).Before(since) {
+			break
+		}
+		// API: GET /api/v1/builds/{id}/resources
+		var resources struct {
+			Outputs []struct {
+				Version map[string]string `json:"version"`
+			} `json:"outputs"`
+		}
+		if err := cc.get(ctx, fmt.Sprintf("builds/%d/resources", build.ID),
+			&resources); err != nil {
+			return time.Time{}, err
+		}
+		var last time.Time
+		for _, output := range resources.Outputs {
+			sent, err := time.Parse(time.RFC3339, output.Version["chat_time"])
+			if err == nil && sent.After(since) && sent.After(last) {
+				last = sent
+			}
+		}
+		if !last.IsZero() {
+			return last, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// concourseJobBuild is an element of the list of the builds of a job.
+type concourseJobBuild struct {
+	ID      int    `json:"id"`
+	Status  string `json:"status"`
+	EndTime int64  `json:"end_time"` // Unix time; zero if still running.
+}
+
+// jobBuilds returns the ID of the current build and the latest builds of the job of
+// env, sorted from the most recent. Some of them can be still running.
+func (cc concourseClient) jobBuilds(ctx context.Context, env Environment,
+) (int, []concourseJobBuild, error) {
+	current, err := strconv.Atoi(env.BuildId)
+	if err != nil {
+		return 0, nil, fmt.Errorf("concourse: BUILD_ID: %s", err)
+	}
+	// API: GET /api/v1/teams/{team}/pipelines/{pipeline}/jobs/{job}/builds
+	query := url.Values{"limit": {fmt.Sprint(concourseBuildsLimit)}}
+	if env.BuildPipelineInstanceVars != "" {
+		query.Set("vars", env.BuildPipelineInstanceVars)
+	}
+	apiPath := path.Join("teams", env.BuildTeamName, "pipelines", env.BuildPipelineName,
+		"jobs", env.BuildJobName, "builds") +
+		// Like in concourseBuildURL, Concourse wants spaces encoded as %20.
+		"?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+	var builds []concourseJobBuild
+	if err := cc.get(ctx, apiPath, &builds); err != nil {
+		return 0, nil, err
+	}
+	return current, builds, nil
+}
+
+// planStep is a step of a build plan that runs something, such as a task.
+type planStep struct {
+	kind string // task, get, put, ...
+	name string
+}
+
+// planStepKinds are the keys of a build plan node that identify a step.
+var planStepKinds = []string{"task", "get", "put", "run", "set_pipeline", "load_var", "check"}
+
+// collectPlanSteps walks the build plan and adds to steps all the steps, by plan id.
+//
+// A build plan is a tree. Each node has an "id" and one key telling its kind: either a
+// step (such as "task": {"name": "unit", ...}) or a modifier containing other nodes (such
+// as "do": [...] or "on_failure": {"step": ..., "on_failure": ...}). Instead of knowing
+// all the modifiers, collectPlanSteps visits any nested JSON object or array.
+func collectPlanSteps(raw json.RawMessage, steps map[string]planStep) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	switch raw[0] {
+	case '[':
+		var nodes []json.RawMessage
+		if err := json.Unmarshal(raw, &nodes); err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if err := collectPlanSteps(node, steps); err != nil {
+				return err
+			}
+		}
+	case '{':
+		var node map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &node); err != nil {
+			return err
+		}
+		var id string
+		if rawID, found := node["id"]; found {
+			_ = json.Unmarshal(rawID, &id)
+		}
+		for _, kind := range planStepKinds {
+			rawStep, found := node[kind]
+			if !found || id == "" {
+				continue
+			}
+			var step struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(rawStep, &step); err == nil && step.Name != "" {
+				steps[id] = planStep{kind: kind, name: step.Name}
+			}
+		}
+		for key, child := range node {
+			if key == "id" {
+				continue
+			}
+			if err := collectPlanSteps(child, steps); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buildEvent is an event of the stream of events of a build.
+type buildEvent struct {
+	Event string `json:"event"` // For example: log, finish-task, error, status.
+	Data  struct {
+		Origin struct {
+			ID     string `json:"id"`     // The plan id of the step.
+			Source string `json:"source"` // For log events: stdout or stderr.
+		} `json:"origin"`
+		Time       int64  `json:"time"`        // Unix time. Not set by all events.
+		ExitStatus *int   `json:"exit_status"` // For finish-* events.
+		Payload    string `json:"payload"`     // For log events.
+		Message    string `json:"message"`     // For error events.
+	} `json:"data"`
+}
+
+// failed reports whether the event is the failure of a step.
+func (ev buildEvent) failed() bool {
+	if ev.Event == "error" {
+		return ev.Data.Origin.ID != ""
+	}
+	return strings.HasPrefix(ev.Event, "finish-") &&
+		ev.Data.ExitStatus != nil && *ev.Data.ExitStatus != 0
+}
+
+// logTail keeps the last max lines of the output of a step, which arrives in chunks
+// not aligned to lines.
+type logTail struct {
+	max     int
+	full    []string
+	partial string // The last line, if not terminated yet.
+}
+
+// ansiEscapeRegexp matches the ANSI escape sequences used by terminals for colors and
+// cursor movements (CSI) and for hyperlinks and window titles (OSC).
+var ansiEscapeRegexp = regexp.MustCompile(
+	`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-_]`)
+
+// write adds chunk to the output.
+func (lt *logTail) write(chunk string) {
+	// Keep the last line raw: it may end with a partial escape sequence.
+	lines := strings.Split(lt.partial+chunk, "\n")
+	lt.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		lt.full = append(lt.full, cleanLogLine(line))
+	}
+	if len(lt.full) > lt.max {
+		lt.full = slices.Clone(lt.full[len(lt.full)-lt.max:])
+	}
+}
+
+// lines returns the last max lines of the output.
+func (lt *logTail) lines() []string {
+	lines := lt.full
+	if lt.partial != "" {
+		lines = append(slices.Clone(lines), cleanLogLine(lt.partial))
+	}
+	return lines[max(0, len(lines)-lt.max):]
+}
+
+// cleanLogLine returns line as it would appear on a terminal: without ANSI escape
+// sequences and, since progress bars rewrite the same line with carriage returns, only
+// with the text after the last one.
+func cleanLogLine(line string) string {
+	line = ansiEscapeRegexp.ReplaceAllString(line, "")
+	line = strings.TrimSuffix(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// events reads the events of the build with the given id, calling fn for each of them,
+// until fn returns false, the stream ends, no event arrives for cc.idleTimeout or ctx
+// expires. Since fn has already seen the events read so far, stopping because of the
+// timeouts is not an error.
+//
+// API: GET /api/v1/builds/{id}/events, as Server-Sent Events:
+//
+//	id: 3
+//	event: event
+//	data: {"data":{"origin":{"id":"6601b8c2"},"exit_status":1},"event":"finish-task"}
+func (cc concourseClient) events(ctx context.Context, buildID string,
+	fn func(buildEvent) bool,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := cc.do(ctx, path.Join("builds", buildID, "events"), "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	idle := time.AfterFunc(cc.idleTimeout, cancel)
+	defer idle.Stop()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		idle.Reset(cc.idleTimeout)
+		line := scanner.Text()
+		if line == "event: end" {
+			return nil
+		}
+		data, found := strings.CutPrefix(line, "data: ")
+		if !found {
+			continue
+		}
+		var ev buildEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("concourse: build events: %s", err)
+		}
+		if !fn(ev) {
+			return nil
+		}
+	}
+	err = scanner.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		cc.log.Info("build events: timeout, using the events read so far")
+		return nil
+	}
+	// Reaching the idle timeout is the normal way to stop reading.
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("concourse: build events: %s", err)
+	}
+	return nil
+}
+
+// get performs a GET on the API endpoint /api/v1/{apiPath} and JSON decodes the reply
+// into reply.
+func (cc concourseClient) get(ctx context.Context, apiPath string, reply any) error {
+	resp, err := cc.do(ctx, apiPath, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(reply); err != nil {
+		return fmt.Errorf("concourse: GET /api/v1/%s: decoding reply: %s", apiPath, err)
+	}
+	return nil
+}
+
+// do performs a GET on the API endpoint /api/v1/{apiPath}. ApiPath can contain a query
+// string. On success, the caller must close the body of the response.
+func (cc concourseClient) do(ctx context.Context, apiPath, accept string,
+) (*http.Response, error) {
+	thePath, query, _ := strings.Cut(apiPath, "?")
+	theURL := cc.server + path.Join("/api/v1", thePath)
+	if query != "" {
+		theURL += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, theURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("concourse: create http request: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+cc.token)
+	req.Header.Set("Accept", accept)
+
+	start := time.Now()
+	resp, err := cc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("concourse: GET /api/v1/%s: %s", thePath, err)
+	}
+	cc.log.Debug("http-request", "method", req.Method, "url", req.URL,
+		"status", resp.StatusCode, "duration", time.Since(start))
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		hint := ""
+		if resp.StatusCode == http.StatusUnauthorized {
+			hint = " (hint: the concourse_token may have expired)"
+		}
+		return nil, fmt.Errorf("concourse: GET /api/v1/%s: %d %s%s: %s", thePath,
+			resp.StatusCode, http.StatusText(resp.StatusCode), hint,
+			strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,475 @@
+package cogito
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/testhelp"
+)
+
+const fakeBuildPlan = `{"schema": "exec.v2", "plan": {"id": "6601b8c2", "do": [
+  {"id": "6601b8c3", "get": {"name": "the-repo", "type": "git"}},
+  {"id": "6601b8c4", "on_failure": {
+    "step": {"id": "6601b8c5", "task": {"name": "unit-tests"}},
+    "on_failure": {"id": "6601b8c6", "put": {"name": "cogito", "type": "cogito"}}
+  }}
+]}}`
+
+// fakeATC returns a fake Concourse ATC serving build 1234 with the given stream of
+// events. If end is false, the stream of events never ends, as for a running build.
+func fakeATC(t *testing.T, events []string, end bool) *httptest.Server {
+	return fakeATCStream(t, events, end, "")
+}
+
+// fakeATCStream is like [fakeATC]; if end is false and repeat is not empty, after
+// events the stream sends repeat every 10ms, as for a step that keeps logging.
+func fakeATCStream(t *testing.T, events []string, end bool, repeat string,
+) *httptest.Server {
+	replies := map[string]string{
+		"/api/v1/builds/1234": `{"id": 1234, "name": "42", "status": "started",
+  "start_time": 1767261600, "created_by": "ada"}`,
+		"/api/v1/builds/1234/plan": fakeBuildPlan,
+		"/api/v1/teams/main/pipelines/the-pipeline/jobs/the-job/builds": `[
+  {"id": 1240, "status": "succeeded", "end_time": 1767262000},
+  {"id": 1234, "status": "started"},
+  {"id": 1230, "status": "started"},
+  {"id": 1220, "status": "failed", "end_time": 1767261000},
+  {"id": 1210, "status": "succeeded", "end_time": 1767250000}
+]`,
+		"/api/v1/builds/1230/resources": `{"inputs": [], "outputs": [
+  {"name": "gh-status", "version": {"ref": "dummy", "state": "pending"}}
+]}`,
+		"/api/v1/builds/1220/resources": `{"inputs": [], "outputs": [
+  {"name": "gh-status", "version": {"ref": "dummy", "state": "pending",
+    "chat_time": "2026-01-01T09:30:00Z"}},
+  {"name": "gh-status", "version": {"ref": "dummy", "state": "failure",
+    "chat_time": "2026-01-01T09:49:00Z"}}
+]}`,
+		"/api/v1/builds/1210/resources": `{"inputs": [], "outputs": [
+  {"name": "gh-status", "version": {"ref": "dummy", "state": "success",
+    "chat_time": "2026-01-01T06:40:00Z"}}
+]}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer the-concourse-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, "not authorized")
+			return
+		}
+		if r.URL.Path == "/api/v1/builds/1234/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i, ev := range events {
+				fmt.Fprintf(w, "id: %d\nevent: event\ndata: %s\n\n", i, ev)
+			}
+			if end {
+				fmt.Fprintf(w, "event: end\ndata\n\n")
+				return
+			}
+			w.(http.Flusher).Flush()
+			if repeat == "" {
+				<-r.Context().Done()
+				return
+			}
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-ticker.C:
+					fmt.Fprintf(w, "event: event\ndata: %s\n\n", repeat)
+					w.(http.Flusher).Flush()
+				}
+			}
+		}
+		reply, found := replies[r.URL.Path]
+		if vars := r.URL.Query().Get("vars"); vars != "" && vars != `{"branch":"feat x"}` {
+			found = false
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, "not found")
+			return
+		}
+		fmt.Fprint(w, reply)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestConcourseFetchBuildSuccess(t *testing.T) {
+	type testCase struct {
+		name     string
+		logLines int
+		events   []string
+		end      bool
+		want     ConcourseBuild
+	}
+
+	startTime := time.Unix(1767261600, 0)
+	now := startTime.Add(83 * time.Second)
+
+	test := func(t *testing.T, tc testCase) {
+		ts := fakeATC(t, tc.events, tc.end)
+		client := newConcourseClient(testhelp.MakeTestLog(),
+			Source{ConcourseURL: ts.URL + "/", ConcourseToken: "the-concourse-token"},
+			Environment{})
+		client.idleTimeout = 100 * time.Millisecond
+		client.logLines = tc.logLines
+
+		have, err := client.fetchBuild("1234", now)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "failed task, build running",
+			events: []string{
+				`{"event": "finish-get", "data": {"origin": {"id": "6601b8c3"}, "exit_status": 0}}`,
+				`{"event": "log", "data": {"origin": {"id": "6601b8c5"}, "payload": "FAIL\n"}}`,
+				`{"event": "finish-task", "data": {"origin": {"id": "6601b8c5"}, "exit_status": 1}}`,
+			},
+			want: ConcourseBuild{
+				StartTime:      startTime,
+				Duration:       83 * time.Second,
+				CreatedBy:      "ada",
+				FailedStep:     "unit-tests",
+				FailedStepType: "task",
+			},
+		},
+		{
+			name:     "failed task with log",
+			logLines: 2,
+			events: []string{
+				`{"event": "log", "data": {"origin": {"id": "6601b8c3"}, "payload": "Cloning\n"}}`,
+				`{"event": "log", "data": {"origin": {"id": "6601b8c5"}, "payload": "=== RUN TestA\n--- FAIL"}}`,
+				`{"event": "log", "data": {"origin": {"id": "6601b8c5"}, "payload": ": TestA\n\u001b[31mFAIL\u001b[0m\n"}}`,
+				`{"event": "finish-task", "data": {"origin": {"id": "6601b8c5"}, "exit_status": 1}}`,
+			},
+			want: ConcourseBuild{
+				StartTime:      startTime,
+				Duration:       83 * time.Second,
+				CreatedBy:      "ada",
+				FailedStep:     "unit-tests",
+				FailedStepType: "task",
+				FailedStepLog:  []string{"--- FAIL: TestA", "FAIL"},
+			},
+		},
+		{
+			name: "errored get, build ended",
+			events: []string{
+				`{"event": "error", "data": {"origin": {"id": "6601b8c3"}, "message": "no versions"}}`,
+			},
+			end: true,
+			want: ConcourseBuild{
+				StartTime:      startTime,
+				Duration:       83 * time.Second,
+				CreatedBy:      "ada",
+				FailedStep:     "the-repo",
+				FailedStepType: "get",
+			},
+		},
+		{
+			name: "no failure",
+			events: []string{
+				`{"event": "finish-get", "data": {"origin": {"id": "6601b8c3"}, "exit_status": 0}}`,
+			},
+			want: ConcourseBuild{
+				StartTime: startTime,
+				Duration:  83 * time.Second,
+				CreatedBy: "ada",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+// A step running in parallel to the put step can keep logging: the stream of events is
+// never idle.
+func TestConcourseFetchBuildBusyStream(t *testing.T) {
+	type testCase struct {
+		name   string
+		repeat string
+	}
+
+	startTime := time.Unix(1767261600, 0)
+	now := startTime.Add(83 * time.Second)
+
+	test := func(t *testing.T, tc testCase) {
+		ts := fakeATCStream(t, []string{
+			`{"event": "finish-get", "data": {"origin": {"id": "6601b8c3"}, "exit_status": 0}}`,
+		}, false, tc.repeat)
+		client := newConcourseClient(testhelp.MakeTestLog(),
+			Source{ConcourseURL: ts.URL, ConcourseToken: "the-concourse-token"},
+			Environment{})
+		client.idleTimeout = 100 * time.Millisecond
+		client.timeout = 500 * time.Millisecond
+
+		have, err := client.fetchBuild("1234", now)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, ConcourseBuild{
+			StartTime: startTime,
+			Duration:  83 * time.Second,
+			CreatedBy: "ada",
+		})
+	}
+
+	testCases := []testCase{
+		{
+			name: "events after the start of the put step",
+			repeat: fmt.Sprintf(
+				`{"event": "log", "data": {"origin": {"id": "6601b8c7"}, "time": %d}}`,
+				now.Unix()+1),
+		},
+		{
+			name:   "timeout",
+			repeat: `{"event": "log", "data": {"origin": {"id": "6601b8c7"}}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestConcourseFetchBuildFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		token   string
+		buildID string
+		events  []string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := fakeATC(t, tc.events, true)
+		client := newConcourseClient(testhelp.MakeTestLog(),
+			Source{ConcourseToken: tc.token}, Environment{AtcExternalUrl: ts.URL})
+
+		_, err := client.fetchBuild(tc.buildID, time.Now())
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "invalid token",
+			token:   "expired",
+			buildID: "1234",
+			wantErr: "concourse: GET /api/v1/builds/1234: 401 Unauthorized (hint: the concourse_token may have expired): not authorized",
+		},
+		{
+			name:    "unknown build",
+			token:   "the-concourse-token",
+			buildID: "999",
+			wantErr: "concourse: GET /api/v1/builds/999: 404 Not Found: not found",
+		},
+		{
+			name:    "invalid event",
+			token:   "the-concourse-token",
+			buildID: "1234",
+			events:  []string{`{"event": `},
+			wantErr: "concourse: build events: unexpected end of JSON input",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestConcoursePreviousBuildStateSuccess(t *testing.T) {
+	type testCase struct {
+		name    string
+		buildID string
+		vars    string
+		want    BuildState
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := fakeATC(t, nil, true)
+		env := Environment{
+			BuildId:                   tc.buildID,
+			BuildTeamName:             "main",
+			BuildPipelineName:         "the-pipeline",
+			BuildPipelineInstanceVars: tc.vars,
+			BuildJobName:              "the-job",
+			AtcExternalUrl:            ts.URL,
+		}
+		client := newConcourseClient(testhelp.MakeTestLog(),
+			Source{ConcourseToken: "the-concourse-token"}, env)
+
+		have, err := client.previousBuildState(env)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "skips running and newer builds",
+			buildID: "1234",
+			want:    StateFailure,
+		},
+		{
+			name:    "instanced pipeline",
+			buildID: "1220",
+			vars:    `{"branch":"feat x"}`,
+			want:    StateSuccess,
+		},
+		{
+			name:    "first build",
+			buildID: "1200",
+			want:    "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestConcoursePreviousBuildStateFailure(t *testing.T) {
+	ts := fakeATC(t, nil, true)
+	env := Environment{
+		BuildId:           "1234",
+		BuildTeamName:     "main",
+		BuildPipelineName: "another-pipeline",
+		BuildJobName:      "the-job",
+		AtcExternalUrl:    ts.URL,
+	}
+	client := newConcourseClient(testhelp.MakeTestLog(),
+		Source{ConcourseToken: "the-concourse-token"}, env)
+
+	_, err := client.previousBuildState(env)
+
+	assert.Error(t, err, "concourse: GET "+
+		"/api/v1/teams/main/pipelines/another-pipeline/jobs/the-job/builds: "+
+		"404 Not Found: not found")
+}
+
+func TestConcourseLastChatTime(t *testing.T) {
+	type testCase struct {
+		name  string
+		since time.Time
+		want  time.Time
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		ts := fakeATC(t, nil, true)
+		env := Environment{
+			BuildId:           "1234",
+			BuildTeamName:     "main",
+			BuildPipelineName: "the-pipeline",
+			BuildJobName:      "the-job",
+			AtcExternalUrl:    ts.URL,
+		}
+		client := newConcourseClient(testhelp.MakeTestLog(),
+			Source{ConcourseToken: "the-concourse-token"}, env)
+
+		have, err := client.lastChatTime(env, tc.since)
+
+		assert.NilError(t, err)
+		assert.Assert(t, have.Equal(tc.want), "have: %s; want: %s", have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:  "skips newer and running builds without chat message",
+			since: time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC),
+			want:  time.Date(2026, 1, 1, 9, 49, 0, 0, time.UTC),
+		},
+		{
+			name:  "chat message older than since",
+			since: time.Date(2026, 1, 1, 9, 45, 0, 0, time.UTC),
+			want:  time.Date(2026, 1, 1, 9, 49, 0, 0, time.UTC),
+		},
+		{
+			name:  "stops at the builds ended before since",
+			since: time.Date(2026, 1, 1, 9, 50, 0, 0, time.UTC),
+			want:  time.Time{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestCollectPlanSteps(t *testing.T) {
+	steps := make(map[string]planStep)
+	plan := fakeBuildPlan[strings.Index(fakeBuildPlan, `{"id"`) : len(fakeBuildPlan)-1]
+
+	err := collectPlanSteps([]byte(plan), steps)
+
+	assert.NilError(t, err)
+	want := map[string]planStep{
+		"6601b8c3": {kind: "get", name: "the-repo"},
+		"6601b8c5": {kind: "task", name: "unit-tests"},
+		"6601b8c6": {kind: "put", name: "cogito"},
+	}
+	assert.Assert(t, maps.Equal(steps, want), "have: %v\nwant: %v", steps, want)
+}
+
+func TestLogTail(t *testing.T) {
+	type testCase struct {
+		name   string
+		chunks []string
+		want   []string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		tail := logTail{max: 3}
+		for _, chunk := range tc.chunks {
+			tail.write(chunk)
+		}
+
+		have := tail.lines()
+
+		assert.DeepEqual(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "keeps the last lines",
+			chunks: []string{"1\n2\n3\n", "4\n5\n"},
+			want:   []string{"3", "4", "5"},
+		},
+		{
+			name:   "unterminated last line",
+			chunks: []string{"1\n2\n3\n4", "2"},
+			want:   []string{"2", "3", "42"},
+		},
+		{
+			name:   "ANSI escapes, also split across chunks",
+			chunks: []string{"\x1b[1;31merror\x1b[0m\n\x1b[3", "2mok\x1b]8;;https://x\x07link\n"},
+			want:   []string{"error", "oklink"},
+		},
+		{
+			name:   "carriage returns of a progress bar",
+			chunks: []string{"10%\r50%\r100%\r\n", "done\r\n"},
+			want:   []string{"100%", "done"},
+		},
+		{
+			name: "empty",
+			want: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,229 @@
+package cogito
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Pix4D/go-kit/googlechat"
+	"github.com/Pix4D/go-kit/retry"
+)
+
+// The Google Chat API supports much more than [googlechat.TextMessage], which can only
+// create a text message. The functions in this file use the webhook (that is, the
+// messages endpoint of a space, with the secrets in the query parameters) also to
+// create a card message or a message with a client-assigned ID, and to update it.
+// A plain text message still goes through [googlechat.TextMessage].
+// See https://developers.google.com/workspace/chat/api/reference/rest/v1/spaces.messages
+
+// gChatMessageID returns the client-assigned message ID of the chat message of the
+// build of env. It is deterministic, so that all the put steps of the same build refer
+// to the same message. The API wants an ID that starts with "client-" and contains
+// only lowercase letters, numbers and hyphens, up to 63 characters.
+func gChatMessageID(env Environment) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{env.BuildTeamName,
+		env.BuildPipelineName, env.BuildPipelineInstanceVars, env.BuildJobName,
+		env.BuildName}, "\x00")))
+	return "client-cogito-" + hex.EncodeToString(sum[:16])
+}
+
+// gChatCreateURL returns the URL to create the message msg via the webhook.
+// If msg has a thread key, the message replies to the thread with that key, or starts
+// it if it does not exist yet.
+func gChatCreateURL(msg gChatMessage) (*url.URL, error) {
+	theURL, err := url.Parse(msg.webHook)
+	if err != nil {
+		return nil, googlechat.RedactErrorURL(err)
+	}
+	values := theURL.Query()
+	if msg.threadKey != "" {
+		values.Set("threadKey", msg.threadKey)
+		// Without it, the API ignores the thread key and starts a new thread.
+		values.Set("messageReplyOption", "REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
+	}
+	if msg.messageID != "" {
+		values.Set("messageId", msg.messageID)
+	}
+	theURL.RawQuery = values.Encode()
+	return theURL, nil
+}
+
+// gChatUpdateURL returns the URL to update the text of the existing message msg via
+// the webhook.
+//
+// API: PATCH /v1/spaces/{space}/messages/{message}?updateMask=text,cardsV2
+func gChatUpdateURL(msg gChatMessage) (*url.URL, error) {
+	theURL, err := url.Parse(msg.webHook)
+	if err != nil {
+		return nil, googlechat.RedactErrorURL(err)
+	}
+	theURL = theURL.JoinPath(msg.messageID)
+	values := theURL.Query()
+	// Replace both, since the format of the message can change between put steps.
+	values.Set("updateMask", "text,cardsV2")
+	theURL.RawQuery = values.Encode()
+	return theURL, nil
+}
+
+// gChatUpsert creates the message msg. If msg has a client-assigned ID and a previous
+// put step of the same build already created it, gChatUpsert replaces its contents.
+//
+// The API documents client-assigned IDs and the update of a message for a Chat app,
+// not for a webhook. If the API rejects either of them, gChatUpsert creates a new
+// message instead, as if source.chat_update_in_place were false, so that the put
+// step does not fail.
+func gChatUpsert(log *slog.Logger, msg gChatMessage) (googlechat.MessageReply, error) {
+	if msg.messageID != "" {
+		reply, err := gChatUpdateInPlace(log, msg)
+		if !errors.Is(err, errGChatRejected) {
+			return reply, err
+		}
+		log.Warn("cannot update the chat message in place, creating a new one",
+			"message-id", msg.messageID, "error", err)
+		msg.messageID = ""
+	}
+	return gChatCreate(log, msg)
+}
+
+// gChatUpdateInPlace creates the message msg with its client-assigned ID or, if it
+// already exists, replaces its contents.
+func gChatUpdateInPlace(log *slog.Logger, msg gChatMessage) (googlechat.MessageReply, error) {
+	body, err := msg.payload()
+	if err != nil {
+		return googlechat.MessageReply{}, err
+	}
+
+	createURL, err := gChatCreateURL(msg)
+	if err != nil {
+		return googlechat.MessageReply{}, err
+	}
+	reply, err := gChatDo(log, http.MethodPost, createURL, body)
+	if !errors.Is(err, errGChatConflict) {
+		return reply, err
+	}
+
+	log.Debug("message exists, updating it", "message-id", msg.messageID)
+	updateURL, err := gChatUpdateURL(msg)
+	if err != nil {
+		return googlechat.MessageReply{}, err
+	}
+	return gChatDo(log, http.MethodPatch, updateURL, body)
+}
+
+// gChatCreate creates the message msg, which has no client-assigned ID.
+func gChatCreate(log *slog.Logger, msg gChatMessage) (googlechat.MessageReply, error) {
+	createURL, err := gChatCreateURL(msg)
+	if err != nil {
+		return googlechat.MessageReply{}, err
+	}
+	if msg.card == nil {
+		// TextMessage can set the threadKey query parameter but not messageReplyOption,
+		// without which the API starts a new thread. TextMessage keeps the query
+		// parameters of the webhook it is passed, so pass the URL that has both.
+		return googlechat.TextMessage(log, googlechat.DefaultRetry(log),
+			googlechat.DefaultTimeout, createURL.String(), msg.threadKey, msg.text)
+	}
+
+	body, err := msg.payload()
+	if err != nil {
+		return googlechat.MessageReply{}, err
+	}
+	return gChatDo(log, http.MethodPost, createURL, body)
+}
+
+// errGChatConflict is returned by [gChatDo] when creating a message whose
+// client-assigned ID already exists.
+var errGChatConflict = errors.New("message already exists")
+
+// errGChatRejected is wrapped by the error returned by [gChatDo] when the API rejects
+// the request with a client error that is not worth retrying.
+var errGChatRejected = errors.New("rejected")
+
+// gChatRetryables are the status codes on which gChatDo retries, the same as
+// [googlechat.TextMessage].
+var gChatRetryables = []int{
+	http.StatusRequestTimeout,      // 408
+	http.StatusTooManyRequests,     // 429
+	http.StatusInternalServerError, // 500
+	http.StatusBadGateway,          // 502
+	http.StatusServiceUnavailable,  // 503
+}
+
+// gChatDo sends body to theURL with method and decodes the reply, retrying on transient
+// errors. Since theURL contains the secrets of the webhook, the errors contain only
+// its redacted form.
+func gChatDo(log *slog.Logger, method string, theURL *url.URL, body []byte,
+) (googlechat.MessageReply, error) {
+	redacted := googlechat.RedactURL(theURL)
+	client := &http.Client{}
+	var replyBody []byte
+	var status int
+	workFn := func() (retry.Action, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), googlechat.DefaultTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, method, theURL.String(),
+			bytes.NewReader(body))
+		if err != nil {
+			return retry.HardFail, googlechat.RedactErrorURL(err)
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return retry.SoftFail, googlechat.RedactErrorURL(err)
+			}
+			return retry.HardFail, googlechat.RedactErrorURL(err)
+		}
+		defer resp.Body.Close()
+		log.Debug("http-request", "method", method, "url", redacted,
+			"status", resp.StatusCode, "duration", time.Since(start))
+
+		status = resp.StatusCode
+		replyBody, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return retry.HardFail, fmt.Errorf("reading body: %s", err)
+		}
+		switch {
+		case status >= 200 && status <= 299:
+			return retry.Success, nil
+		case status == http.StatusConflict:
+			return retry.HardFail, errGChatConflict
+		case slices.Contains(gChatRetryables, status):
+			return retry.SoftFail, fmt.Errorf("status: %d %s", status,
+				http.StatusText(status))
+		case status >= 400 && status <= 499:
+			return retry.HardFail, fmt.Errorf("%w: status: %d %s; body: %s",
+				errGChatRejected, status, http.StatusText(status),
+				strings.TrimSpace(string(replyBody)))
+		default:
+			return retry.HardFail, fmt.Errorf("status: %d %s; body: %s", status,
+				http.StatusText(status), strings.TrimSpace(string(replyBody)))
+		}
+	}
+	if err := googlechat.DefaultRetry(log).Do(retry.ExponentialBackoff, workFn); err != nil {
+		if errors.Is(err, errGChatConflict) {
+			return googlechat.MessageReply{}, err
+		}
+		return googlechat.MessageReply{}, fmt.Errorf("%s %s: %w", method, redacted, err)
+	}
+
+	var reply googlechat.MessageReply
+	if err := json.Unmarshal(replyBody, &reply); err != nil {
+		return googlechat.MessageReply{},
+			fmt.Errorf("%s %s: decoding reply: %s", method, redacted, err)
+	}
+	return reply, nil
+}
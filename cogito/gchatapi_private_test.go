@@ -0,0 +1,95 @@
+package cogito
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/testhelp"
+)
+
+func TestGChatMessageID(t *testing.T) {
+	env := Environment{
+		BuildTeamName:     "main",
+		BuildPipelineName: "the-pipeline",
+		BuildJobName:      "the-job",
+		BuildName:         "42",
+	}
+	other := env
+	other.BuildName = "43"
+
+	id := gChatMessageID(env)
+
+	assert.Assert(t, regexp.MustCompile(`^client-[a-z0-9-]{1,56}$`).MatchString(id), id)
+	assert.Equal(t, gChatMessageID(env), id, "want: deterministic")
+	assert.Assert(t, gChatMessageID(other) != id, "want: one message per build")
+}
+
+func TestGChatCreateURL(t *testing.T) {
+	type testCase struct {
+		name string
+		msg  gChatMessage
+		want string
+	}
+
+	const webHook = "https://chat.example/v1/spaces/the-space/messages?key=the-key"
+
+	test := func(t *testing.T, tc testCase) {
+		have, err := gChatCreateURL(tc.msg)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have.String(), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "reply to thread",
+			msg:  gChatMessage{webHook: webHook, threadKey: "the pipeline"},
+			want: webHook + "&messageReplyOption=REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD" +
+				"&threadKey=the+pipeline",
+		},
+		{
+			name: "new thread, client-assigned ID",
+			msg:  gChatMessage{webHook: webHook, messageID: "client-the-id"},
+			want: webHook + "&messageId=client-the-id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGChatUpdateURL(t *testing.T) {
+	msg := gChatMessage{
+		webHook:   "https://chat.example/v1/spaces/the-space/messages?key=the-key&token=the-token",
+		messageID: "client-the-id",
+	}
+
+	have, err := gChatUpdateURL(msg)
+
+	assert.NilError(t, err)
+	assert.Equal(t, have.String(), "https://chat.example/v1/spaces/the-space/messages/"+
+		"client-the-id?key=the-key&token=the-token&updateMask=text%2CcardsV2")
+}
+
+func TestGChatDoFailureRedactsSecrets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(ts.Close)
+	theURL, err := url.Parse(ts.URL + "/v1/spaces/the-space/messages?key=sensitive")
+	assert.NilError(t, err)
+
+	_, err = gChatDo(testhelp.MakeTestLog(), http.MethodPost, theURL, []byte("{}"))
+
+	assert.ErrorContains(t, err, "/v1/spaces/the-space/messages?REDACTED: rejected: status: 403 Forbidden")
+	assert.Assert(t, !strings.Contains(err.Error(), "sensitive"))
+	assert.Assert(t, errors.Is(err, errGChatRejected))
+}
@@ -0,0 +1,205 @@
+package cogito
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Pix4D/cogito/gitobj"
+)
+
+// Values of source and put param gchat_format.
+const (
+	GChatFormatText = "text" // Default.
+	GChatFormatCard = "card"
+)
+
+// validateGChatFormat verifies the value of key gchat_format.
+func validateGChatFormat(format string) error {
+	switch format {
+	case "", GChatFormatText, GChatFormatCard:
+		return nil
+	default:
+		return fmt.Errorf("gchat_format: invalid value: %q (valid: %s, %s)",
+			format, GChatFormatCard, GChatFormatText)
+	}
+}
+
+// gChatCardMessage is a Google Chat message made of a card. Compared to the full API,
+// only the needed fields are present.
+// See https://developers.google.com/workspace/chat/api/reference/rest/v1/cards
+type gChatCardMessage struct {
+	Text string `json:"text,omitempty"` // Shown above the card.
+	// Shown in the notifications, where the card cannot be rendered.
+	FallbackText string      `json:"fallbackText"`
+	CardsV2      []gChatCard `json:"cardsV2"`
+}
+
+type gChatCard struct {
+	CardID string        `json:"cardId"`
+	Card   gChatCardBody `json:"card"`
+}
+
+type gChatCardBody struct {
+	Header   gChatCardHeader    `json:"header"`
+	Sections []gChatCardSection `json:"sections"`
+}
+
+type gChatCardHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type gChatCardSection struct {
+	Header  string        `json:"header,omitempty"`
+	Widgets []gChatWidget `json:"widgets"`
+}
+
+// gChatWidget is a union: exactly one of the fields is set.
+type gChatWidget struct {
+	DecoratedText *gChatDecoratedText `json:"decoratedText,omitempty"`
+	TextParagraph *gChatTextParagraph `json:"textParagraph,omitempty"`
+	ButtonList    *gChatButtonList    `json:"buttonList,omitempty"`
+}
+
+type gChatDecoratedText struct {
+	TopLabel string `json:"topLabel"`
+	Text     string `json:"text"` // Supports a subset of HTML.
+}
+
+type gChatTextParagraph struct {
+	Text string `json:"text"` // Supports a subset of HTML.
+}
+
+type gChatButtonList struct {
+	Buttons []gChatButton `json:"buttons"`
+}
+
+type gChatButton struct {
+	Text    string       `json:"text"`
+	OnClick gChatOnClick `json:"onClick"`
+}
+
+type gChatOnClick struct {
+	OpenLink struct {
+		URL string `json:"url"`
+	} `json:"openLink"`
+}
+
+// stateColor returns the color of state, the same as the Concourse UI.
+func stateColor(state BuildState) string {
+	switch state {
+	case StateAbort:
+		return "#8b572a"
+	case StateError:
+		return "#f5a623"
+	case StateFailure:
+		return "#ed4b35"
+	case StatePending:
+		return "#f1c40f"
+	case StateSuccess:
+		return "#11c560"
+	default:
+		return "#9b9b9b"
+	}
+}
+
+// gChatBuildSummaryCard returns the build summary as a card, with the same contents as
+// [gChatBuildSummaryText]. Commit, pr, build and change can be nil.
+func gChatBuildSummaryCard(gitRef string, commit *gitobj.Commit, pr *PullRequest,
+	build *ConcourseBuild, change *StateChange, state BuildState, src Source,
+	env Environment,
+) gChatCardMessage {
+	job := fmt.Sprintf("%s/%s", env.BuildJobName, env.BuildName)
+	title := decorateState(state)
+	if change != nil && change.Transition != "" {
+		title += fmt.Sprintf(" (%s)", change)
+	}
+	header := gChatCardHeader{
+		Title:    title,
+		Subtitle: fmt.Sprintf("%s %s", env.BuildPipelineName, job),
+	}
+
+	// The values come from the outside world: escape them, since the text of the
+	// widgets is HTML.
+	esc := html.EscapeString
+	var widgets []gChatWidget
+	addText := func(label, text string) {
+		widgets = append(widgets, gChatWidget{
+			DecoratedText: &gChatDecoratedText{TopLabel: label, Text: text},
+		})
+	}
+	addText("state", fmt.Sprintf(`<font color="%s">%s</font>`, stateColor(state),
+		esc(string(state))))
+	addText("pipeline", esc(env.BuildPipelineName))
+	addText("job", esc(job))
+	buttons := []gChatButton{newGChatButton("Open build", concourseBuildURL(env))}
+
+	if build != nil && build.FailedStep != "" {
+		addText("failed step", esc(build.FailedStepType+" "+build.FailedStep))
+	}
+	if build != nil && build.Duration > 0 {
+		addText("duration", build.Duration.String())
+	}
+	createdBy := env.BuildCreatedBy
+	if build != nil && build.CreatedBy != "" {
+		createdBy = build.CreatedBy
+	}
+	if createdBy != "" {
+		addText("triggered by", esc(createdBy))
+	}
+	// An empty gitRef means that cogito has been configured as chat only.
+	if gitRef != "" {
+		commitURL := fmt.Sprintf("https://%s/%s/%s/commit/%s",
+			src.GhHostname, src.Owner, src.Repo, gitRef)
+		addText("commit",
+			esc(fmt.Sprintf("%.10s (repo: %s/%s)", gitRef, src.Owner, src.Repo)))
+		if commit != nil {
+			addText("subject", esc(commit.Subject))
+			addText("author", esc(commit.Author.Name))
+		}
+		buttons = append(buttons, newGChatButton("Open commit", commitURL))
+	}
+	if pr != nil {
+		addText("pull request", esc(fmt.Sprintf("#%s %s", pr.Number, pr.Title)))
+		buttons = append(buttons, newGChatButton("Open pull request", pr.URL))
+	}
+	widgets = append(widgets, gChatWidget{ButtonList: &gChatButtonList{Buttons: buttons}})
+
+	sections := []gChatCardSection{{Widgets: widgets}}
+	if build != nil && len(build.FailedStepLog) > 0 {
+		lines := make([]string, 0, len(build.FailedStepLog))
+		for _, line := range build.FailedStepLog {
+			lines = append(lines, esc(line))
+		}
+		// Like for the text format, drop the oldest lines to stay within the limits.
+		for len(lines) > 0 &&
+			utf8.RuneCountInString(strings.Join(lines, "<br>")) > gChatMaxTextLen {
+			lines = lines[1:]
+		}
+		if len(lines) > 0 {
+			sections = append(sections, gChatCardSection{
+				Header: esc(fmt.Sprintf("output of %s %s", build.FailedStepType,
+					build.FailedStep)),
+				Widgets: []gChatWidget{{TextParagraph: &gChatTextParagraph{
+					Text: strings.Join(lines, "<br>"),
+				}}},
+			})
+		}
+	}
+
+	return gChatCardMessage{
+		FallbackText: fmt.Sprintf("%s %s %s", stateIcon(state), env.BuildPipelineName, job),
+		CardsV2: []gChatCard{{
+			CardID: "cogito-build-summary",
+			Card:   gChatCardBody{Header: header, Sections: sections},
+		}},
+	}
+}
+
+func newGChatButton(text, url string) gChatButton {
+	button := gChatButton{Text: text}
+	button.OnClick.OpenLink.URL = url
+	return button
+}
@@ -0,0 +1,83 @@
+package cogito
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+
+	"github.com/Pix4D/cogito/gitobj"
+)
+
+func TestGChatBuildSummaryCard(t *testing.T) {
+	commit := gitobj.Commit{
+		Author:  gitobj.Signature{Name: "Ada Lovelace"},
+		Subject: "Render <b> as bold",
+	}
+	pr := PullRequest{Number: "42", URL: "https://github.com/the-owner/the-repo/pull/42"}
+	build := ConcourseBuild{
+		Duration:       83 * time.Second,
+		FailedStep:     "unit-tests",
+		FailedStepType: "task",
+		FailedStepLog:  []string{"--- FAIL: TestA", "FAIL"},
+	}
+	change := StateChange{Previous: StateSuccess, Transition: TransitionBroken}
+	src := Source{Owner: "the-owner", Repo: "the-repo", GhHostname: "github.com"}
+	env := Environment{
+		BuildName:         "7",
+		BuildJobName:      "the-job",
+		BuildPipelineName: "the-pipeline",
+		BuildTeamName:     "main",
+		AtcExternalUrl:    "https://ci.example",
+	}
+
+	card := gChatBuildSummaryCard("deadbeef", &commit, &pr, &build, &change, StateFailure,
+		src, env)
+
+	assert.Equal(t, card.FallbackText, "🔴 the-pipeline the-job/7")
+	body := card.CardsV2[0].Card
+	assert.Equal(t, body.Header.Title, "🔴 failure (broken, was success)")
+	assert.Equal(t, body.Header.Subtitle, "the-pipeline the-job/7")
+
+	labels := make(map[string]string)
+	var buttons []gChatButton
+	for _, widget := range body.Sections[0].Widgets {
+		if widget.DecoratedText != nil {
+			labels[widget.DecoratedText.TopLabel] = widget.DecoratedText.Text
+		}
+		if widget.ButtonList != nil {
+			buttons = widget.ButtonList.Buttons
+		}
+	}
+	assert.Equal(t, labels["state"], `<font color="#ed4b35">failure</font>`)
+	assert.Equal(t, labels["subject"], "Render &lt;b&gt; as bold")
+	assert.Equal(t, labels["failed step"], "task unit-tests")
+	assert.Equal(t, labels["duration"], "1m23s")
+	assert.Equal(t, len(buttons), 3)
+	assert.Equal(t, buttons[0].OnClick.OpenLink.URL,
+		"https://ci.example/teams/main/pipelines/the-pipeline/jobs/the-job/builds/7")
+	assert.Equal(t, buttons[1].OnClick.OpenLink.URL,
+		"https://github.com/the-owner/the-repo/commit/deadbeef")
+	assert.Equal(t, buttons[2].OnClick.OpenLink.URL, pr.URL)
+
+	assert.Equal(t, len(body.Sections), 2)
+	assert.Equal(t, body.Sections[1].Widgets[0].TextParagraph.Text, "--- FAIL: TestA<br>FAIL")
+
+	data, err := json.Marshal(card)
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Contains(string(data),
+		`"buttonList":{"buttons":[{"text":"Open build","onClick":{"openLink":{"url":`))
+}
+
+func TestGChatBuildSummaryCardChatOnly(t *testing.T) {
+	card := gChatBuildSummaryCard("", nil, nil, nil, nil, StateSuccess, Source{},
+		Environment{BuildJobName: "the-job", BuildName: "7"})
+
+	widgets := card.CardsV2[0].Card.Sections[0].Widgets
+	buttons := widgets[len(widgets)-1].ButtonList.Buttons
+	assert.Equal(t, len(buttons), 1)
+	assert.Equal(t, buttons[0].Text, "Open build")
+	assert.Equal(t, len(card.CardsV2[0].Card.Sections), 1)
+}
@@ -1,101 +1,339 @@
 package cogito
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/Pix4D/cogito/gitobj"
 	"github.com/Pix4D/go-kit/googlechat"
 )
 
 // GoogleChatSink is an implementation of [Sinker] for the Cogito resource.
 type GoogleChatSink struct {
-	Log      *slog.Logger
-	InputDir fs.FS
-	GitRef   string
-	Request  PutRequest
+	Log         *slog.Logger
+	InputDir    fs.FS
+	GitRef      string
+	Branch      string          // Empty if not available.
+	Commit      *gitobj.Commit  // Nil if not available.
+	PullRequest *PullRequest    // Nil if not available.
+	Build       *ConcourseBuild // Nil if not available.
+	StateChange *StateChange    // Nil if not available.
+	// Email of a commit author to chat user ID (users/<id>), nil if not configured.
+	Mentions map[string]string
+	// The reason not to send, see source.chat_quiet_hours and chat_min_interval.
+	Suppressed string
+	Sent       *bool // If not nil, Send sets it to true when it posts a message.
+	Request    PutRequest
 }
 
-// Send sends a message to Google Chat if the configuration matches.
-func (sink GoogleChatSink) Send() error {
-	sink.Log.Debug("send: started")
-	defer sink.Log.Debug("send: finished")
+// gChatMaxTextLen is the maximum length of the text of a Google Chat message.
+// See https://developers.google.com/workspace/chat/format-messages
+const gChatMaxTextLen = 4096
+
+// Values of source key chat_thread_mode.
+const (
+	ChatThreadModeThread            = "thread" // Default.
+	ChatThreadModeNewThreadPerBuild = "new_thread_per_build"
+	ChatThreadModeNone              = "none"
+)
+
+// validateChatThreadMode verifies the value of key chat_thread_mode.
+func validateChatThreadMode(mode string) error {
+	switch mode {
+	case "", ChatThreadModeThread, ChatThreadModeNewThreadPerBuild, ChatThreadModeNone:
+		return nil
+	default:
+		return fmt.Errorf("chat_thread_mode: invalid value: %q (valid: %s, %s, %s)",
+			mode, ChatThreadModeNewThreadPerBuild, ChatThreadModeNone, ChatThreadModeThread)
+	}
+}
 
-	// If present, params.gchat_webhook overrides source.gchat_webhook.
-	webHook := sink.Request.Source.GChatWebHook
-	if sink.Request.Params.GChatWebHook != "" {
-		webHook = sink.Request.Params.GChatWebHook
+// gChatMessage contains what is needed to post a message to Google Chat.
+type gChatMessage struct {
+	webHook   string // SENSITIVE
+	threadKey string // If empty, the message starts a new thread.
+	messageID string // Client-assigned; empty unless source.chat_update_in_place.
+	text      string
+	card      *gChatCardMessage // If set, text is empty.
+}
+
+// payload returns the JSON body of the request to create msg.
+func (msg gChatMessage) payload() ([]byte, error) {
+	if msg.card != nil {
+		return json.Marshal(msg.card)
+	}
+	return json.Marshal(googlechat.BasicMessage{Text: msg.text})
+}
+
+// prepare returns the message that Send would post. If the configuration says not
+// to send, prepare returns false.
+func (sink GoogleChatSink) prepare() (gChatMessage, bool, error) {
+	request := sink.Request
+	state := request.Params.State
+	// If present, params.gchat_webhook overrides source.gchat_webhook and source.routes.
+	webHook := request.Source.GChatWebHook
+	switch {
+	case request.Params.GChatWebHook != "":
+		webHook = request.Params.GChatWebHook
 		sink.Log.Debug("params.gchat_webhook is overriding source.gchat_webhook")
+	case len(request.Source.Routes) > 0:
+		idx := matchRoute(request, sink.Branch, sink.StateChange)
+		if idx < 0 {
+			sink.Log.Info("not sending to chat", "reason", "no matching route",
+				"state", state)
+			return gChatMessage{}, false, nil
+		}
+		sink.Log.Debug("matched route", "index", idx)
+		route := request.Source.Routes[idx]
+		webHook = route.WebHook
+		request.Source.ChatNotifyOnStates = route.notifyOnStates(request.Source)
 	}
 	if webHook == "" {
 		sink.Log.Info("not sending to chat", "reason", "feature not enabled")
-		return nil
+		return gChatMessage{}, false, nil
 	}
 
-	state := sink.Request.Params.State
-	if !shouldSendToChat(sink.Request) {
+	if !shouldSendToChat(request, sink.StateChange) {
 		sink.Log.Debug("not sending to chat",
-			"reason", "state not in configured states", "state", state)
-		return nil
+			"reason", "state and transition not in configured ones", "state", state)
+		return gChatMessage{}, false, nil
+	}
+	if sink.Suppressed != "" {
+		sink.Log.Info("not sending to chat", "reason", sink.Suppressed, "state", state)
+		return gChatMessage{}, false, nil
 	}
 
-	text, err := prepareChatMessage(sink.InputDir, sink.Request, sink.GitRef)
+	threadKey, err := gChatThreadKey(request, sink.GitRef, sink.Commit, sink.Build)
 	if err != nil {
-		return fmt.Errorf("GoogleChatSink: %s", err)
+		return gChatMessage{}, false, fmt.Errorf("GoogleChatSink: %s", err)
+	}
+	msg := gChatMessage{webHook: webHook, threadKey: threadKey}
+	params := request.Params
+	mention := gChatMention(sink.Mentions, sink.Commit, state)
+	// A custom message is free text: it cannot become a card.
+	if params.GChatFormat == GChatFormatCard &&
+		params.ChatMessage == "" && params.ChatMessageFile == "" {
+		card := gChatBuildSummaryCard(sink.GitRef, sink.Commit, sink.PullRequest,
+			sink.Build, sink.StateChange, state, request.Source, request.Env)
+		// A mention in a card does not notify the user: it must be in the text.
+		card.Text = mention
+		msg.card = &card
+	} else {
+		text, err := prepareChatMessage(sink.Log, sink.InputDir, request, sink.GitRef,
+			sink.Commit, sink.PullRequest, sink.Build, sink.StateChange, mention)
+		if err != nil {
+			return gChatMessage{}, false, fmt.Errorf("GoogleChatSink: %s", err)
+		}
+		msg.text = text
+	}
+	if request.Source.ChatUpdateInPlace {
+		msg.messageID = gChatMessageID(request.Env)
+	}
+	return msg, true, nil
+}
+
+// Plan returns the request to Google Chat that Send would perform.
+func (sink GoogleChatSink) Plan() ([]SinkRequest, error) {
+	msg, ok, err := sink.prepare()
+	if err != nil || !ok {
+		return nil, err
+	}
+	theURL, err := url.Parse(msg.webHook)
+	if err != nil {
+		return nil, fmt.Errorf("GoogleChatSink: %s", googlechat.RedactErrorURL(err))
+	}
+	// The webhook carries the secrets in the query parameters: redact their values
+	// but keep the keys, then add the parameters of the thread and of the message.
+	values := theURL.Query()
+	for key := range values {
+		values.Set(key, "REDACTED")
+	}
+	theURL.RawQuery = values.Encode()
+	theURL.User = nil
+	msg.webHook = theURL.String()
+	// If the message already exists, Send updates it instead.
+	createURL, err := gChatCreateURL(msg)
+	if err != nil {
+		return nil, fmt.Errorf("GoogleChatSink: %s", err)
+	}
+	body, err := msg.payload()
+	if err != nil {
+		return nil, fmt.Errorf("GoogleChatSink: %s", err)
+	}
+
+	return []SinkRequest{{
+		Sink:   "gchat",
+		Method: http.MethodPost,
+		URL:    createURL.String(),
+		Body:   string(body),
+	}}, nil
+}
+
+// Send sends a message to Google Chat if the configuration matches.
+func (sink GoogleChatSink) Send() error {
+	sink.Log.Debug("send: started")
+	defer sink.Log.Debug("send: finished")
+
+	msg, ok, err := sink.prepare()
+	if err != nil || !ok {
+		return err
 	}
 
-	threadKey := fmt.Sprintf("%s %s", sink.Request.Env.BuildPipelineName, sink.GitRef)
-	sink.Log.Debug("posting-to-chat", "text", text)
-	reply, err := googlechat.TextMessage(sink.Log, googlechat.DefaultRetry(sink.Log),
-		googlechat.DefaultTimeout, webHook, threadKey, text)
+	sink.Log.Debug("posting-to-chat", "text", msg.text, "thread-key", msg.threadKey)
+	reply, err := gChatUpsert(sink.Log, msg)
 	if err != nil {
 		return fmt.Errorf("GoogleChatSink: %s", err)
 	}
+	if sink.Sent != nil {
+		*sink.Sent = true
+	}
 
 	spaceURL := reply.SpaceURL()
-	sink.Log.Info("posted-to-chat", "state", state, "space", spaceURL)
+	sink.Log.Info("posted-to-chat", "state", sink.Request.Params.State, "space", spaceURL)
 	return nil
 }
 
-// shouldSendToChat returns true if the state is configured to do so.
-func shouldSendToChat(request PutRequest) bool {
+// gChatThreadKey returns the thread key of the message for request, according to
+// source keys chat_thread_mode and chat_thread_key. Commit and build can be nil.
+// The empty string means a new thread for each message.
+func gChatThreadKey(request PutRequest, gitRef string, commit *gitobj.Commit,
+	build *ConcourseBuild,
+) (string, error) {
+	src := request.Source
+	env := request.Env
+	switch src.ChatThreadMode {
+	case ChatThreadModeNone:
+		return "", nil
+	case ChatThreadModeNewThreadPerBuild:
+		// All the put steps of a build, and only them, share the thread.
+		return fmt.Sprintf("%s/%s%s/%s/%s", env.BuildTeamName, env.BuildPipelineName,
+			env.BuildPipelineInstanceVars, env.BuildJobName, env.BuildName), nil
+	default:
+		if src.ChatThreadKey == "" {
+			return fmt.Sprintf("%s %s", env.BuildPipelineName, gitRef), nil
+		}
+		key, err := expandTemplate("chat_thread_key", src.ChatThreadKey,
+			newTemplateData(request, gitRef, commit, build))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(key), nil
+	}
+}
+
+// shouldSendToChat returns true if the state or the transition (change can be nil) is
+// configured to do so.
+func shouldSendToChat(request PutRequest, change *StateChange) bool {
 	if request.Params.ChatMessage != "" || request.Params.ChatMessageFile != "" {
 		return true
 	}
+	if change != nil && change.Transition != "" &&
+		slices.Contains(request.Source.ChatNotifyOnTransitions, change.Transition) {
+		return true
+	}
 	return slices.Contains(request.Source.ChatNotifyOnStates, request.Params.State)
 }
 
-// prepareChatMessage returns a message ready to be sent to the chat sink.
-func prepareChatMessage(inputDir fs.FS, request PutRequest, gitRef string,
+// gChatMention returns the mention of the author of commit, such as "<users/123>", if
+// state is failing and mentions has an entry for the email of the author. Otherwise,
+// it returns the empty string. Commit can be nil.
+func gChatMention(mentions map[string]string, commit *gitobj.Commit, state BuildState,
+) string {
+	if !isFailing(state) || commit == nil || commit.Author.Email == "" {
+		return ""
+	}
+	// Emails are compared case-insensitively, as done in practice by mail servers.
+	for email, user := range mentions {
+		if strings.EqualFold(email, commit.Author.Email) {
+			return "<" + user + ">"
+		}
+	}
+	return ""
+}
+
+// prepareChatMessage returns a message ready to be sent to the chat sink. If mention
+// is not empty, the message starts with it. Commit, pr, build and change can be nil.
+func prepareChatMessage(log *slog.Logger, inputDir fs.FS, request PutRequest, gitRef string,
+	commit *gitobj.Commit, pr *PullRequest, build *ConcourseBuild, change *StateChange,
+	mention string,
 ) (string, error) {
 	params := request.Params
+	data := newTemplateData(request, gitRef, commit, build)
+	if change != nil {
+		data.PreviousState = change.Previous
+		data.Transition = change.Transition
+	}
 
 	var parts []string
 	if params.ChatMessage != "" {
-		parts = append(parts, params.ChatMessage)
+		parts = append(parts,
+			expandTemplateOrText(log, "chat_message", params.ChatMessage, data))
 	}
 	if params.ChatMessageFile != "" {
 		contents, err := fs.ReadFile(inputDir, params.ChatMessageFile)
 		if err != nil {
 			return "", fmt.Errorf("reading chat_message_file: %s", err)
 		}
-		parts = append(parts, string(contents))
+		parts = append(parts,
+			expandTemplateOrText(log, params.ChatMessageFile, string(contents), data))
 	}
 
 	if len(parts) == 0 || (len(parts) > 0 && params.ChatAppendSummary) {
 		parts = append(
 			parts,
-			gChatBuildSummaryText(gitRef, params.State, request.Source, request.Env))
+			gChatBuildSummaryText(gitRef, commit, pr, build, change, params.State,
+				request.Source, request.Env))
+	}
+
+	// The mention comes first, to be visible in the notification.
+	if mention != "" {
+		parts = slices.Insert(parts, 0, mention)
+	}
+
+	// The log excerpt comes last and takes the space left, if any.
+	if build != nil && len(build.FailedStepLog) > 0 {
+		text := strings.Join(parts, "\n\n")
+		left := gChatMaxTextLen - utf8.RuneCountInString(text) - len("\n\n")
+		if excerpt := gChatLogExcerpt(build, left); excerpt != "" {
+			parts = append(parts, excerpt)
+		}
 	}
 
 	return strings.Join(parts, "\n\n"), nil
 }
 
+// gChatLogExcerpt returns the tail of the output of the failed step of build as a
+// code block, with at most maxLen runes. To fit, it drops the oldest lines; if not even
+// the last line fits, it returns the empty string.
+func gChatLogExcerpt(build *ConcourseBuild, maxLen int) string {
+	header := fmt.Sprintf("*output of %s %s*\n", build.FailedStepType, build.FailedStep)
+	// Backticks in the output would close the code block.
+	lines := make([]string, 0, len(build.FailedStepLog))
+	for _, line := range build.FailedStepLog {
+		lines = append(lines, strings.ReplaceAll(line, "```", "'''"))
+	}
+	for ; len(lines) > 0; lines = lines[1:] {
+		excerpt := header + "```\n" + strings.Join(lines, "\n") + "\n```"
+		if utf8.RuneCountInString(excerpt) <= maxLen {
+			return excerpt
+		}
+	}
+	return ""
+}
+
 // gChatBuildSummaryText returns a plain text message to be sent to Google Chat.
-func gChatBuildSummaryText(gitRef string, state BuildState, src Source, env Environment,
+// Commit, pr, build and change can be nil.
+func gChatBuildSummaryText(gitRef string, commit *gitobj.Commit, pr *PullRequest,
+	build *ConcourseBuild, change *StateChange, state BuildState, src Source,
+	env Environment,
 ) string {
 	now := time.Now().Format("2006-01-02 15:04:05 MST")
 
@@ -112,35 +350,64 @@ func gChatBuildSummaryText(gitRef string, state BuildState, src Source, env Envi
 	fmt.Fprintf(&bld, "%s\n", now)
 	fmt.Fprintf(&bld, "*pipeline* %s\n", env.BuildPipelineName)
 	fmt.Fprintf(&bld, "*job* %s\n", job)
-	fmt.Fprintf(&bld, "*state* %s\n", decorateState(state))
+	if change != nil && change.Transition != "" {
+		fmt.Fprintf(&bld, "*state* %s (%s)\n", decorateState(state), change)
+	} else {
+		fmt.Fprintf(&bld, "*state* %s\n", decorateState(state))
+	}
+	if build != nil {
+		if build.FailedStep != "" {
+			fmt.Fprintf(&bld, "*failed step* %s %s\n", build.FailedStepType, build.FailedStep)
+		}
+		if build.Duration > 0 {
+			fmt.Fprintf(&bld, "*duration* %s\n", build.Duration)
+		}
+	}
+	// Without the Concourse API, BUILD_CREATED_BY is set only for manual builds.
+	createdBy := env.BuildCreatedBy
+	if build != nil && build.CreatedBy != "" {
+		createdBy = build.CreatedBy
+	}
+	if createdBy != "" {
+		fmt.Fprintf(&bld, "*triggered by* %s\n", createdBy)
+	}
 	// An empty gitRef means that cogito has been configured as chat only.
 	if gitRef != "" {
 		commitUrl := fmt.Sprintf("https://%s/%s/%s/commit/%s",
 			src.GhHostname, src.Owner, src.Repo, gitRef)
-		commit := fmt.Sprintf("<%s|%.10s> (repo: %s/%s)",
+		commitLink := fmt.Sprintf("<%s|%.10s> (repo: %s/%s)",
 			commitUrl, gitRef, src.Owner, src.Repo)
-		fmt.Fprintf(&bld, "*commit* %s\n", commit)
+		fmt.Fprintf(&bld, "*commit* %s\n", commitLink)
+		if commit != nil {
+			fmt.Fprintf(&bld, "*subject* %s\n", commit.Subject)
+			fmt.Fprintf(&bld, "*author* %s\n", commit.Author.Name)
+		}
+	}
+	if pr != nil {
+		fmt.Fprintf(&bld, "*pull request* <%s|#%s> %s\n", pr.URL, pr.Number, pr.Title)
 	}
 
 	return bld.String()
 }
 
 func decorateState(state BuildState) string {
-	var icon string
+	return fmt.Sprintf("%s %s", stateIcon(state), state)
+}
+
+// stateIcon returns the icon for state, with the same color as the Concourse UI.
+func stateIcon(state BuildState) string {
 	switch state {
 	case StateAbort:
-		icon = "🟤"
+		return "🟤"
 	case StateError:
-		icon = "🟠"
+		return "🟠"
 	case StateFailure:
-		icon = "🔴"
+		return "🔴"
 	case StatePending:
-		icon = "🟡"
+		return "🟡"
 	case StateSuccess:
-		icon = "🟢"
+		return "🟢"
 	default:
-		icon = "❓"
+		return "❓"
 	}
-
-	return fmt.Sprintf("%s %s", icon, state)
 }
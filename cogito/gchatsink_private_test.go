@@ -4,9 +4,14 @@ import (
 	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
+	"unicode/utf8"
 
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
+
+	"github.com/Pix4D/cogito/gitobj"
+	"github.com/Pix4D/cogito/testhelp"
 )
 
 func TestShouldSendToChatDefaultConfig(t *testing.T) {
@@ -20,7 +25,7 @@ func TestShouldSendToChatDefaultConfig(t *testing.T) {
 		request.Source.ChatNotifyOnStates = defaultNotifyStates
 		request.Params.State = tc.state
 
-		assert.Equal(t, shouldSendToChat(request), tc.want)
+		assert.Equal(t, shouldSendToChat(request, nil), tc.want)
 	}
 
 	testCases := []testCase{
@@ -47,7 +52,7 @@ func TestShouldSendToChatCustomConfig(t *testing.T) {
 		request.Source.ChatNotifyOnStates = []BuildState{StatePending, StateSuccess}
 		request.Params.State = tc.state
 
-		assert.Equal(t, shouldSendToChat(request), tc.want)
+		assert.Equal(t, shouldSendToChat(request, nil), tc.want)
 	}
 
 	testCases := []testCase{
@@ -64,7 +69,8 @@ func TestShouldSendToChatCustomConfig(t *testing.T) {
 }
 
 func TestPrepareChatMessageOnlyChatSuccess(t *testing.T) {
-	have, err := prepareChatMessage(nil, PutRequest{}, "")
+	have, err := prepareChatMessage(testhelp.MakeTestLog(), nil, PutRequest{}, "", nil, nil, nil,
+		nil, "")
 
 	assert.NilError(t, err)
 	assert.Check(t, !strings.Contains(have, "commit"), "not wanted: commit")
@@ -99,7 +105,8 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 	customFile := "from-custom-file"
 
 	test := func(t *testing.T, tc testCase) {
-		have, err := prepareChatMessage(tc.inputDir, tc.makeReq(), baseGitRef)
+		have, err := prepareChatMessage(testhelp.MakeTestLog(), tc.inputDir, tc.makeReq(),
+			baseGitRef, nil, nil, nil, nil, "")
 
 		assert.NilError(t, err)
 		for _, elem := range tc.wantPresent {
@@ -199,14 +206,91 @@ func TestPrepareChatMessageSuccess(t *testing.T) {
 	}
 }
 
+func TestPrepareChatMessageTemplateSuccess(t *testing.T) {
+	request := PutRequest{
+		Params: PutParams{
+			State:           StateFailure,
+			ChatMessage:     "{{emoji .State}} {{.BuildJobName}}",
+			ChatMessageFile: "registration/msg.txt",
+			Vars:            map[string]string{"who": "the-team"},
+		},
+		Env: Environment{BuildJobName: "the-job"},
+	}
+	inputDir := fstest.MapFS{
+		"registration/msg.txt": {Data: []byte("commit {{.ShortGitRef}} by {{.Vars.who}}")},
+	}
+
+	have, err := prepareChatMessage(testhelp.MakeTestLog(), inputDir, request, "deadbeef0123",
+		nil, nil, nil, nil, "")
+
+	assert.NilError(t, err)
+	assert.Equal(t, have, "🔴 the-job\n\ncommit deadbee by the-team")
+}
+
+func TestPrepareChatMessageTemplateErrorUsesText(t *testing.T) {
+	type testCase struct {
+		name string
+		text string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{Params: PutParams{ChatMessageFile: "bar/msg.txt"}}
+		inputDir := fstest.MapFS{"bar/msg.txt": {Data: []byte(tc.text)}}
+
+		have, err := prepareChatMessage(testhelp.MakeTestLog(), inputDir, request,
+			"deadbeef", nil, nil, nil, nil, "")
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.text)
+	}
+
+	testCases := []testCase{
+		{
+			name: "parse error",
+			text: `{{ foo | default("x") }}`,
+		},
+		{
+			name: "execution error",
+			text: "\n{{.Vars.pizza}}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestPrepareChatMessageFailure(t *testing.T) {
-	request := PutRequest{Params: PutParams{ChatMessageFile: "foo/msg.txt"}}
-	inputDir := fstest.MapFS{"bar/msg.txt": {Data: []byte("from-custom-file")}}
+	type testCase struct {
+		name    string
+		params  PutParams
+		wantErr string
+	}
 
-	_, err := prepareChatMessage(inputDir, request, "deadbeef")
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{Params: tc.params}
+		inputDir := fstest.MapFS{
+			"bar/msg.txt":  {Data: []byte("from-custom-file")},
+			"bar/tmpl.txt": {Data: []byte("\n{{.Vars.pizza}}")},
+		}
+
+		_, err := prepareChatMessage(testhelp.MakeTestLog(), inputDir, request, "deadbeef", nil, nil,
+			nil, nil, "")
 
-	assert.Error(t, err,
-		"reading chat_message_file: open foo/msg.txt: file does not exist")
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing chat_message_file",
+			params:  PutParams{ChatMessageFile: "foo/msg.txt"},
+			wantErr: "reading chat_message_file: open foo/msg.txt: file does not exist",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
 }
 
 func TestGChatBuildSummaryText(t *testing.T) {
@@ -223,7 +307,7 @@ func TestGChatBuildSummaryText(t *testing.T) {
 		AtcExternalUrl:    "https://cogito.example",
 	}
 
-	have := gChatBuildSummaryText(commit, state, src, env)
+	have := gChatBuildSummaryText(commit, nil, nil, nil, nil, state, src, env)
 
 	assert.Assert(t, cmp.Contains(have, "*pipeline* the-pipeline"))
 	assert.Assert(t, cmp.Regexp(`\*job\* <https:.+\|the-job\/42>`, have))
@@ -233,6 +317,287 @@ func TestGChatBuildSummaryText(t *testing.T) {
 		have))
 }
 
+func TestGChatBuildSummaryTextWithCommit(t *testing.T) {
+	commit := gitobj.Commit{
+		Author:  gitobj.Signature{Name: "Ada Lovelace", Email: "ada@example.com"},
+		Subject: "Spell out 200",
+	}
+
+	have := gChatBuildSummaryText("deadbeef", &commit, nil, nil, nil, StateSuccess,
+		Source{Owner: "the-owner", Repo: "the-repo"}, Environment{})
+
+	assert.Assert(t, cmp.Contains(have, "*subject* Spell out 200\n"))
+	assert.Assert(t, cmp.Contains(have, "*author* Ada Lovelace\n"))
+}
+
+func TestGChatBuildSummaryTextWithPullRequest(t *testing.T) {
+	pr := PullRequest{
+		Number: "42",
+		URL:    "https://github.com/the-owner/the-repo/pull/42",
+		Title:  "Add the banana feature",
+	}
+
+	have := gChatBuildSummaryText("deadbeef", nil, &pr, nil, nil, StateSuccess,
+		Source{Owner: "the-owner", Repo: "the-repo"}, Environment{})
+
+	assert.Assert(t, cmp.Contains(have,
+		"*pull request* <https://github.com/the-owner/the-repo/pull/42|#42> Add the banana feature\n"))
+}
+
+func TestGChatBuildSummaryTextWithConcourseBuild(t *testing.T) {
+	build := ConcourseBuild{
+		Duration:       83 * time.Second,
+		CreatedBy:      "ada",
+		FailedStep:     "unit-tests",
+		FailedStepType: "task",
+	}
+
+	have := gChatBuildSummaryText("deadbeef", nil, nil, &build, nil, StateFailure,
+		Source{Owner: "the-owner", Repo: "the-repo"}, Environment{})
+
+	assert.Assert(t, cmp.Contains(have, "*failed step* task unit-tests\n"))
+	assert.Assert(t, cmp.Contains(have, "*duration* 1m23s\n"))
+	assert.Assert(t, cmp.Contains(have, "*triggered by* ada\n"))
+}
+
+func TestGChatBuildSummaryTextWithoutConcourseBuild(t *testing.T) {
+	have := gChatBuildSummaryText("deadbeef", nil, nil, nil, nil, StateFailure,
+		Source{Owner: "the-owner", Repo: "the-repo"}, Environment{BuildCreatedBy: "ada"})
+
+	assert.Assert(t, cmp.Contains(have, "*triggered by* ada\n"))
+	assert.Assert(t, !strings.Contains(have, "*failed step*"))
+	assert.Assert(t, !strings.Contains(have, "*duration*"))
+}
+
+func TestPrepareChatMessageWithLogExcerpt(t *testing.T) {
+	request := PutRequest{
+		Source: Source{Owner: "the-owner", Repo: "the-repo"},
+		Params: PutParams{State: StateFailure, ChatMessage: "the-custom-message"},
+	}
+	build := ConcourseBuild{
+		FailedStep:     "unit-tests",
+		FailedStepType: "task",
+		FailedStepLog:  []string{"--- FAIL: TestA", "FAIL"},
+	}
+
+	have, err := prepareChatMessage(testhelp.MakeTestLog(), nil, request, "deadbeef", nil, nil,
+		&build, nil, "")
+
+	assert.NilError(t, err)
+	assert.Equal(t, have, "the-custom-message\n\n"+
+		"*output of task unit-tests*\n```\n--- FAIL: TestA\nFAIL\n```")
+}
+
+func TestGChatLogExcerpt(t *testing.T) {
+	type testCase struct {
+		name   string
+		maxLen int
+		want   string
+	}
+
+	build := ConcourseBuild{
+		FailedStep:     "unit-tests",
+		FailedStepType: "task",
+		FailedStepLog:  []string{"first", "second ```go", "third"},
+	}
+	header := "*output of task unit-tests*\n"
+
+	test := func(t *testing.T, tc testCase) {
+		have := gChatLogExcerpt(&build, tc.maxLen)
+
+		assert.Equal(t, have, tc.want)
+		assert.Assert(t, utf8.RuneCountInString(have) <= tc.maxLen)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "everything fits",
+			maxLen: gChatMaxTextLen,
+			want:   header + "```\nfirst\nsecond '''go\nthird\n```",
+		},
+		{
+			name:   "drops the oldest lines",
+			maxLen: len(header) + 20,
+			want:   header + "```\nthird\n```",
+		},
+		{
+			name:   "nothing fits",
+			maxLen: len(header) + 5,
+			want:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestShouldSendToChatTransitions(t *testing.T) {
+	type testCase struct {
+		name   string
+		change *StateChange
+		want   bool
+	}
+
+	request := PutRequest{
+		Source: Source{ChatNotifyOnTransitions: []Transition{TransitionBroken, TransitionFixed}},
+		Params: PutParams{State: StateFailure},
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Equal(t, shouldSendToChat(request, tc.change), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "configured transition",
+			change: &StateChange{Previous: StateSuccess, Transition: TransitionBroken},
+			want:   true,
+		},
+		{
+			name:   "transition not configured",
+			change: &StateChange{Previous: StateFailure, Transition: TransitionStillFailing},
+			want:   false,
+		},
+		{
+			name:   "previous state unknown",
+			change: nil,
+			want:   false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGChatBuildSummaryTextWithStateChange(t *testing.T) {
+	change := StateChange{Previous: StateFailure, Transition: TransitionFixed}
+
+	have := gChatBuildSummaryText("deadbeef", nil, nil, nil, &change, StateSuccess,
+		Source{Owner: "the-owner", Repo: "the-repo"}, Environment{})
+
+	assert.Assert(t, cmp.Contains(have, "*state* 🟢 success (fixed, was failure)\n"))
+}
+
+func TestGChatMention(t *testing.T) {
+	type testCase struct {
+		name   string
+		state  BuildState
+		commit *gitobj.Commit
+		want   string
+	}
+
+	mentions := map[string]string{"Ada@Example.com": "users/111"}
+	ada := &gitobj.Commit{Author: gitobj.Signature{Email: "ada@example.com"}}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Equal(t, gChatMention(mentions, tc.commit, tc.state), tc.want)
+	}
+
+	testCases := []testCase{
+		{name: "failure", state: StateFailure, commit: ada, want: "<users/111>"},
+		{name: "error", state: StateError, commit: ada, want: "<users/111>"},
+		{name: "success", state: StateSuccess, commit: ada, want: ""},
+		{name: "abort", state: StateAbort, commit: ada, want: ""},
+		{
+			name:   "no mapping",
+			state:  StateFailure,
+			commit: &gitobj.Commit{Author: gitobj.Signature{Email: "grace@example.com"}},
+			want:   "",
+		},
+		{name: "no commit", state: StateFailure, want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPrepareChatMessageWithMention(t *testing.T) {
+	request := PutRequest{Params: PutParams{
+		State:             StateFailure,
+		ChatMessage:       "the custom message",
+		ChatAppendSummary: true,
+	}}
+
+	have, err := prepareChatMessage(testhelp.MakeTestLog(), nil, request, "deadbeef", nil, nil,
+		nil, nil, "<users/111>")
+
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(have, "<users/111>\n\nthe custom message\n\n"), have)
+	assert.Assert(t, cmp.Contains(have, "*state* 🔴 failure"))
+}
+
+func TestGChatThreadKeySuccess(t *testing.T) {
+	type testCase struct {
+		name   string
+		source Source
+		want   string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{
+			Source: tc.source,
+			Env: Environment{
+				BuildTeamName:             "main",
+				BuildPipelineName:         "the-pipeline",
+				BuildPipelineInstanceVars: `{"branch":"stable"}`,
+				BuildJobName:              "the-job",
+				BuildName:                 "42",
+			},
+		}
+
+		have, err := gChatThreadKey(request, "deadbeef", nil, nil)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "default: pipeline and commit",
+			want: "the-pipeline deadbeef",
+		},
+		{
+			name:   "custom key: one thread per branch",
+			source: Source{ChatThreadKey: "{{.BuildPipelineName}} {{.BuildPipelineInstanceVars}}\n"},
+			want:   `the-pipeline {"branch":"stable"}`,
+		},
+		{
+			name: "custom key: one thread per job per day",
+			source: Source{
+				ChatThreadMode: ChatThreadModeThread,
+				ChatThreadKey:  `{{.BuildJobName}} {{date "2006"}}`,
+			},
+			want: "the-job " + time.Now().UTC().Format("2006"),
+		},
+		{
+			name:   "new thread per build",
+			source: Source{ChatThreadMode: ChatThreadModeNewThreadPerBuild},
+			want:   `main/the-pipeline{"branch":"stable"}/the-job/42`,
+		},
+		{
+			name:   "no threading",
+			source: Source{ChatThreadMode: ChatThreadModeNone},
+			want:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGChatThreadKeyFailure(t *testing.T) {
+	request := PutRequest{Source: Source{ChatThreadKey: "{{.Pizza}}"}}
+
+	_, err := gChatThreadKey(request, "deadbeef", nil, nil)
+
+	assert.ErrorContains(t, err,
+		`template: chat_thread_key:1:2: executing "chat_thread_key" at <.Pizza>: can't evaluate field Pizza`)
+}
+
 func TestStateToIcon(t *testing.T) {
 	type testCase struct {
 		state BuildState
@@ -5,9 +5,13 @@
 package cogito_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path"
+	"sync"
 	"testing"
 	"testing/fstest"
 
@@ -40,9 +44,11 @@ func TestSinkGoogleChatSendSuccess(t *testing.T) {
 		}
 		tc.setWebHook(&request, ts.URL)
 		assert.NilError(t, request.Source.Validate())
+		var sent bool
 		sink := cogito.GoogleChatSink{
 			Log:     testhelp.MakeTestLog(),
 			GitRef:  wantGitRef,
+			Sent:    &sent,
 			Request: request,
 		}
 
@@ -50,9 +56,12 @@ func TestSinkGoogleChatSendSuccess(t *testing.T) {
 
 		assert.NilError(t, err)
 		ts.Close() // Avoid races before the following asserts.
+		assert.Assert(t, sent)
 		assert.Assert(t, cmp.Contains(message.Text, "*state* 🟠 error"))
 		assert.Assert(t, cmp.Contains(message.Text, "*pipeline* the-test-pipeline"))
-		assert.Assert(t, cmp.Contains(URL.String(), "/?threadKey=the-test-pipeline+deadbeef"))
+		assert.Equal(t, URL.Query().Get("threadKey"), "the-test-pipeline deadbeef")
+		assert.Equal(t, URL.Query().Get("messageReplyOption"),
+			"REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
 	}
 
 	testCases := []testCase{
@@ -75,21 +84,54 @@ func TestSinkGoogleChatSendSuccess(t *testing.T) {
 	}
 }
 
+func TestSinkGoogleChatSendRoutes(t *testing.T) {
+	var message googlechat.BasicMessage
+	var URL *url.URL
+	ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL, http.StatusOK)
+	request := basePutRequest
+	request.Source.Sinks = []string{"gchat"}
+	request.Source.Routes = []cogito.Route{
+		{Jobs: []string{"release-*"}, WebHook: "https://wrong.example"},
+		{Branches: []string{"main"}, WebHook: ts.URL + "/team-space"},
+	}
+	request.Params = cogito.PutParams{State: cogito.StateFailure}
+	request.Env = cogito.Environment{BuildJobName: "unit"}
+	assert.NilError(t, request.Source.Validate())
+	sink := cogito.GoogleChatSink{
+		Log:     testhelp.MakeTestLog(),
+		GitRef:  "deadbeef",
+		Branch:  "main",
+		Request: request,
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, URL.Path, "/team-space")
+	assert.Assert(t, cmp.Contains(message.Text, "*state* 🔴 failure"))
+}
+
 func TestSinkGoogleChatDecidesNotToSendSuccess(t *testing.T) {
 	type testCase struct {
-		name    string
-		request cogito.PutRequest
+		name       string
+		request    cogito.PutRequest
+		suppressed string
 	}
 
 	test := func(t *testing.T, tc testCase) {
+		var sent bool
 		sink := cogito.GoogleChatSink{
-			Log:     testhelp.MakeTestLog(),
-			Request: tc.request,
+			Log:        testhelp.MakeTestLog(),
+			Request:    tc.request,
+			Suppressed: tc.suppressed,
+			Sent:       &sent,
 		}
 
 		err := sink.Send()
 
 		assert.NilError(t, err)
+		assert.Assert(t, !sent)
 	}
 
 	testCases := []testCase{
@@ -107,6 +149,30 @@ func TestSinkGoogleChatDecidesNotToSendSuccess(t *testing.T) {
 				Params: cogito.PutParams{State: cogito.StatePending}, // not sent by default
 			},
 		},
+		{
+			name: "suppressed",
+			request: cogito.PutRequest{
+				Source: cogito.Source{
+					GChatWebHook:       "https://cogito.example",
+					ChatNotifyOnStates: []cogito.BuildState{cogito.StateError},
+				},
+				Params: cogito.PutParams{State: cogito.StateError},
+			},
+			suppressed: "chat_quiet_hours 22:00-07:00 UTC",
+		},
+		{
+			name: "no matching route",
+			request: cogito.PutRequest{
+				Source: cogito.Source{
+					ChatNotifyOnStates: []cogito.BuildState{cogito.StateError},
+					Routes: []cogito.Route{
+						{Jobs: []string{"release-*"}, WebHook: "https://cogito.example"},
+					},
+				},
+				Params: cogito.PutParams{State: cogito.StateError},
+				Env:    cogito.Environment{BuildJobName: "unit"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -134,6 +200,201 @@ func TestSinkGoogleChatSendBackendFailure(t *testing.T) {
 	ts.Close()
 }
 
+func TestSinkGoogleChatUpdateInPlace(t *testing.T) {
+	// A fake Google Chat space that supports client-assigned message IDs.
+	var requests []string
+	messages := make(map[string]string)
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var msg googlechat.BasicMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, r.Method)
+		var name string
+		switch r.Method {
+		case http.MethodPost:
+			id := r.URL.Query().Get("messageId")
+			if _, found := messages[id]; found {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			name = id
+		case http.MethodPatch:
+			name = path.Base(r.URL.Path)
+			if r.URL.Query().Get("updateMask") != "text,cardsV2" || messages[name] == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		messages[name] = msg.Text
+		fmt.Fprintf(w, `{"name": "spaces/the-space/messages/%s"}`, name)
+	}))
+	t.Cleanup(ts.Close)
+
+	request := basePutRequest
+	request.Source.GChatWebHook = ts.URL + "/v1/spaces/the-space/messages?key=sensitive"
+	request.Source.ChatUpdateInPlace = true
+	request.Source.ChatNotifyOnStates = []cogito.BuildState{
+		cogito.StatePending, cogito.StateSuccess}
+	request.Env = cogito.Environment{
+		BuildPipelineName: "the-test-pipeline",
+		BuildJobName:      "the-test-job",
+		BuildName:         "42",
+	}
+	assert.NilError(t, request.Source.Validate())
+
+	for _, state := range []cogito.BuildState{cogito.StatePending, cogito.StateSuccess} {
+		request.Params.State = state
+		sink := cogito.GoogleChatSink{
+			Log:     testhelp.MakeTestLog(),
+			GitRef:  "deadbeef",
+			Request: request,
+		}
+
+		assert.NilError(t, sink.Send())
+	}
+
+	ts.Close() // Avoid races before the following asserts.
+	assert.DeepEqual(t, requests, []string{"POST", "POST", "PATCH"})
+	assert.Equal(t, len(messages), 1)
+	for _, text := range messages {
+		assert.Assert(t, cmp.Contains(text, "*state* 🟢 success"))
+	}
+}
+
+func TestSinkGoogleChatUpdateInPlaceRejected(t *testing.T) {
+	type testCase struct {
+		name         string
+		reject       string // The method rejected with a client-assigned message ID.
+		wantRequests []string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		// A fake Google Chat space that rejects the client-assigned message IDs.
+		var requests []string
+		var texts []string
+		var mu sync.Mutex
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			id := r.URL.Query().Get("messageId")
+			if id == "" && r.Method == http.MethodPatch {
+				id = path.Base(r.URL.Path)
+			}
+			requests = append(requests, fmt.Sprintf("%s %t", r.Method, id != ""))
+			switch {
+			case id != "" && r.Method == tc.reject:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			case id != "" && r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			var msg googlechat.BasicMessage
+			if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			texts = append(texts, msg.Text)
+			fmt.Fprintln(w, `{"name": "spaces/the-space/messages/the-message"}`)
+		}))
+		t.Cleanup(ts.Close)
+
+		request := basePutRequest
+		request.Source.GChatWebHook = ts.URL + "/v1/spaces/the-space/messages?key=sensitive"
+		request.Source.ChatUpdateInPlace = true
+		request.Params.State = cogito.StateFailure
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GoogleChatSink{
+			Log:     testhelp.MakeTestLog(),
+			GitRef:  "deadbeef",
+			Request: request,
+		}
+
+		assert.NilError(t, sink.Send())
+
+		ts.Close() // Avoid races before the following asserts.
+		assert.DeepEqual(t, requests, tc.wantRequests)
+		assert.Equal(t, len(texts), 1)
+		assert.Assert(t, cmp.Contains(texts[0], "*state* 🔴 failure"))
+	}
+
+	testCases := []testCase{
+		{
+			name:         "message ID rejected",
+			reject:       http.MethodPost,
+			wantRequests: []string{"POST true", "POST false"},
+		},
+		{
+			name:         "update rejected",
+			reject:       http.MethodPatch,
+			wantRequests: []string{"POST true", "PATCH true", "POST false"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSinkGoogleChatSendFormat(t *testing.T) {
+	type testCase struct {
+		name        string
+		chatMessage string
+		wantCard    bool
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var message map[string]any
+		var URL *url.URL
+		ts := testhelp.SpyHttpServer(&message, googlechat.MessageReply{}, &URL, http.StatusOK)
+		request := basePutRequest
+		request.Source.GChatWebHook = ts.URL
+		request.Source.GChatFormat = cogito.GChatFormatCard
+		request.Params = cogito.PutParams{
+			State:       cogito.StateError,
+			ChatMessage: tc.chatMessage,
+			GChatFormat: cogito.GChatFormatCard,
+		}
+		assert.NilError(t, request.Source.Validate())
+		sink := cogito.GoogleChatSink{
+			Log:     testhelp.MakeTestLog(),
+			GitRef:  "deadbeef",
+			Request: request,
+		}
+
+		err := sink.Send()
+
+		assert.NilError(t, err)
+		ts.Close() // Avoid races before the following asserts.
+		_, hasCard := message["cardsV2"]
+		_, hasText := message["text"]
+		assert.Equal(t, hasCard, tc.wantCard)
+		assert.Equal(t, hasText, !tc.wantCard)
+		assert.Assert(t, cmp.Contains(URL.String(), "threadKey="))
+	}
+
+	testCases := []testCase{
+		{
+			name:     "build summary as card",
+			wantCard: true,
+		},
+		{
+			name:        "custom message falls back to text",
+			chatMessage: "the-custom-message",
+			wantCard:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestSinkGoogleChatSendInputFailure(t *testing.T) {
 	request := basePutRequest
 	request.Params.ChatMessageFile = "foo/msg.txt"
@@ -1,14 +1,19 @@
 package cogito
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 // Get implements the "get" step (the "in" executable).
-// For the Cogito resource, this is a no-op.
+// For the Cogito resource, this is a no-op, unless the version is emitted by the check
+// step in watch mode: see [fetchStatuses].
 //
 // From https://concourse-ci.org/implementing-resource-types.html#resource-in:
 //
@@ -42,12 +47,21 @@ func Get(log *slog.Logger, input []byte, out io.Writer, args []string) error {
 
 	// args[0] contains the path to a Concourse volume and a normal resource would fetch
 	// and put there the requested version of the resource.
-	// In this resource we do nothing, but we still check for protocol conformance.
+	// In this resource we do nothing for the dummy version, but we still check for
+	// protocol conformance.
 	if len(args) == 0 {
 		return fmt.Errorf("get: arguments: missing output directory")
 	}
 	log.Debug("", "output-directory", args[0])
 
+	// A version emitted by put (it has a time) describes what put posted: it is the
+	// implicit get after the put, there is nothing to fetch.
+	if isGitSHA(request.Version.Ref) && request.Version.Time == "" {
+		if err := fetchStatuses(log, request.Source, request.Version, args[0]); err != nil {
+			return fmt.Errorf("get: %s", err)
+		}
+	}
+
 	// Following the protocol for get, we return the same version as the requested one.
 	output := Output{Version: request.Version}
 	enc := json.NewEncoder(out)
@@ -59,3 +73,62 @@ func Get(log *slog.Logger, input []byte, out io.Writer, args []string) error {
 		"output.metadata", output.Metadata)
 	return nil
 }
+
+// fetchStatuses writes into outputDir the GitHub commit statuses (and, if
+// source.watch_check_runs is set, the check runs) of the commit of version:
+//
+//   - statuses.json: the list of [ContextStatus].
+//   - sha: the commit SHA.
+//   - context: the context of version (empty if none).
+//   - state: the state of version if it has a context; otherwise, the combined state.
+//   - target_url: the target URL of the context of version (empty if none).
+func fetchStatuses(log *slog.Logger, source Source, version Version, outputDir string,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	gh, err := newGhClient(ctx, log, source)
+	if err != nil {
+		return err
+	}
+	sha, statuses, err := gh.CommitStatuses(ctx, version.Ref, source.WatchCheckRuns)
+	if err != nil {
+		return err
+	}
+	log.Debug("fetched", "sha", sha, "statuses", len(statuses))
+
+	state := version.State
+	if version.Context == "" {
+		state = ghCombinedState(statuses)
+	}
+	var targetURL string
+	for _, st := range statuses {
+		if st.Context == version.Context {
+			targetURL = st.TargetURL
+			break
+		}
+	}
+
+	buf, err := json.MarshalIndent(statuses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding statuses: %s", err)
+	}
+	files := []struct {
+		name     string
+		contents string
+	}{
+		{"statuses.json", string(buf) + "\n"},
+		{"sha", sha},
+		{"context", version.Context},
+		{"state", state},
+		{"target_url", targetURL},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(outputDir, file.name),
+			[]byte(file.contents), 0o644); err != nil {
+			return fmt.Errorf("writing output: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -3,6 +3,9 @@ package cogito_test
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -163,3 +166,145 @@ func TestGetNonEmptyParamsFailure(t *testing.T) {
 
 	assert.Error(t, err, wantErr)
 }
+
+func TestGetStatusesSuccess(t *testing.T) {
+	type testCase struct {
+		name      string
+		version   cogito.Version
+		checkRuns bool
+		want      map[string]string // file name -> contents
+		wantN     int               // number of elements of statuses.json
+	}
+
+	const sha = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	const statuses = `{"sha": "` + sha + `", "statuses": [
+  {"context": "lint", "state": "success", "target_url": "https://ci.example.org/lint",
+   "updated_at": "2026-01-01T10:01:00Z"},
+  {"context": "unit", "state": "pending", "updated_at": "2026-01-01T10:02:00Z"}
+]}`
+	const checkRuns = `{"check_runs": [
+  {"name": "e2e", "status": "completed", "conclusion": "timed_out",
+   "details_url": "https://ci.example.org/e2e", "completed_at": "2026-01-01T10:03:00Z"}
+]}`
+
+	test := func(t *testing.T, tc testCase) {
+		ts := githubStatusServer(t, sha, statuses, checkRuns)
+		source := cogito.Source{
+			Owner:          "the-owner",
+			Repo:           "the-repo",
+			AccessToken:    "the-token",
+			GhHostname:     strings.TrimPrefix(ts.URL, "http://"),
+			WatchBranch:    "main",
+			WatchCheckRuns: tc.checkRuns,
+		}
+		in := testhelp.ToJSON(t, cogito.GetRequest{Source: source, Version: tc.version})
+		outDir := t.TempDir()
+		var out bytes.Buffer
+
+		err := cogito.Get(testhelp.MakeTestLog(), in, &out, []string{outDir})
+
+		assert.NilError(t, err)
+		var have cogito.Output
+		testhelp.FromJSON(t, out.Bytes(), &have)
+		assert.DeepEqual(t, have, cogito.Output{Version: tc.version})
+		for name, want := range tc.want {
+			buf, err := os.ReadFile(filepath.Join(outDir, name))
+			assert.NilError(t, err)
+			assert.Equal(t, string(buf), want, "file %s", name)
+		}
+		buf, err := os.ReadFile(filepath.Join(outDir, "statuses.json"))
+		assert.NilError(t, err)
+		var haveStatuses []cogito.ContextStatus
+		testhelp.FromJSON(t, buf, &haveStatuses)
+		assert.Equal(t, len(haveStatuses), tc.wantN)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "version with context",
+			version: cogito.Version{Ref: sha, Context: "lint", State: "success"},
+			want: map[string]string{
+				"sha": sha, "context": "lint", "state": "success",
+				"target_url": "https://ci.example.org/lint",
+			},
+			wantN: 2,
+		},
+		{
+			name:    "version without context: combined state",
+			version: cogito.Version{Ref: sha},
+			want:    map[string]string{"sha": sha, "context": "", "state": "pending", "target_url": ""},
+			wantN:   2,
+		},
+		{
+			name:      "with check runs",
+			version:   cogito.Version{Ref: sha},
+			checkRuns: true,
+			want:      map[string]string{"state": "failure"},
+			wantN:     3,
+		},
+		{
+			name:      "version with context of a check run",
+			version:   cogito.Version{Ref: sha, Context: "e2e", State: "failure"},
+			checkRuns: true,
+			want: map[string]string{
+				"context": "e2e", "state": "failure",
+				"target_url": "https://ci.example.org/e2e",
+			},
+			wantN: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGetNoOp(t *testing.T) {
+	type testCase struct {
+		name    string
+		version cogito.Version
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		in := testhelp.ToJSON(t, cogito.GetRequest{
+			Source: cogito.Source{
+				Owner: "the-owner", Repo: "the-repo", AccessToken: "the-token",
+				// Would fail if contacted.
+				GhHostname: "127.0.0.1:1",
+			},
+			Version: tc.version,
+		})
+		outDir := t.TempDir()
+		var out bytes.Buffer
+
+		err := cogito.Get(testhelp.MakeTestLog(), in, &out, []string{outDir})
+
+		assert.NilError(t, err)
+		var have cogito.Output
+		testhelp.FromJSON(t, out.Bytes(), &have)
+		assert.DeepEqual(t, have, cogito.Output{Version: tc.version})
+		entries, err := os.ReadDir(outDir)
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 0)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "dummy version",
+			version: cogito.DummyVersion,
+		},
+		{
+			name: "version emitted by put (implicit get)",
+			version: cogito.Version{
+				Ref:     "af6cd86e98eb1485f04d38b78d9532e916bbff02",
+				Context: "the-job",
+				State:   "success",
+				Time:    "2026-03-04T09:30:00Z",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
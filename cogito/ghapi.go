@@ -0,0 +1,261 @@
+package cogito
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Pix4D/go-kit/github"
+	"github.com/Pix4D/go-kit/retry"
+)
+
+// ContextStatus is the state of a context on a commit, as reported either by the GitHub
+// Commit status API or by the GitHub Checks API. Since the two APIs are independent,
+// the same commit can have a status and a check run with the same name.
+type ContextStatus struct {
+	Kind        string    `json:"kind"` // One of: status, check_run.
+	Context     string    `json:"context"`
+	State       string    `json:"state"` // One of: error, failure, pending, success.
+	Description string    `json:"description"`
+	TargetURL   string    `json:"target_url"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const (
+	kindStatus   = "status"
+	kindCheckRun = "check_run"
+)
+
+// ghPerPage is the maximum page size of the GitHub API. Cogito reads only the first
+// page: a commit with more than 100 statuses or check runs is not supported.
+const ghPerPage = 100
+
+// ghClient reads from the GitHub API for source.owner/repo.
+// The GitHub Commit status sink, instead, writes via [github.CommitStatus].
+type ghClient struct {
+	log    *slog.Logger
+	target *github.Target
+	token  string
+	owner  string
+	repo   string
+}
+
+// newGhClient returns a ghClient authenticated with the access token or with the
+// GitHub app of source.
+func newGhClient(ctx context.Context, log *slog.Logger, source Source,
+) (ghClient, error) {
+	httpClient := &http.Client{}
+	server := github.ApiRoot(source.GhHostname)
+
+	// Check and get need the secrets only in watch mode, so they are read here. Put
+	// has already read them; reading again is harmless.
+	if err := source.readSecretEnvs(); err != nil {
+		return ghClient{}, fmt.Errorf("source: %s", err)
+	}
+	// The _file variants are read from the put inputs, which check and get do not have.
+	if source.AccessToken == "" && source.AccessTokenFile != "" {
+		return ghClient{}, fmt.Errorf(
+			"access_token_file is supported only by put: use access_token_env")
+	}
+	if source.GitHubApp.PrivateKey == "" && source.GitHubAppPrivateKeyFile != "" {
+		return ghClient{}, fmt.Errorf(
+			"github_app_private_key_file is supported only by put: use github_app_private_key_env")
+	}
+
+	token := source.AccessToken
+	// if access token is not configured, we are using github_app
+	// so we must generate the installation token
+	if token == "" {
+		installationToken, err := github.GenerateInstallationToken(ctx, httpClient,
+			server, source.GitHubApp)
+		if err != nil {
+			return ghClient{}, err
+		}
+		token = installationToken
+	}
+
+	return ghClient{
+		log: log,
+		target: &github.Target{
+			Client: httpClient,
+			Server: server,
+			Retry:  github.DefaultRetry(log),
+		},
+		token: token,
+		owner: source.Owner,
+		repo:  source.Repo,
+	}, nil
+}
+
+// CommitStatuses returns the SHA that ref (a branch, a tag or a SHA) resolves to and
+// the latest status of each context on that SHA. If checkRuns is true, it returns
+// also the check runs.
+func (gh ghClient) CommitStatuses(ctx context.Context, ref string, checkRuns bool,
+) (string, []ContextStatus, error) {
+	// API: GET /repos/{owner}/{repo}/commits/{ref}/status
+	// The combined status contains only the latest status of each context.
+	var combined struct {
+		SHA      string `json:"sha"`
+		Statuses []struct {
+			Context     string    `json:"context"`
+			State       string    `json:"state"`
+			Description string    `json:"description"`
+			TargetURL   string    `json:"target_url"`
+			UpdatedAt   time.Time `json:"updated_at"`
+		} `json:"statuses"`
+	}
+	if err := gh.get(ctx, path.Join("commits", ref, "status"), &combined); err != nil {
+		return "", nil, err
+	}
+
+	statuses := make([]ContextStatus, 0, len(combined.Statuses))
+	for _, st := range combined.Statuses {
+		statuses = append(statuses, ContextStatus{
+			Kind:        kindStatus,
+			Context:     st.Context,
+			State:       st.State,
+			Description: st.Description,
+			TargetURL:   st.TargetURL,
+			UpdatedAt:   st.UpdatedAt,
+		})
+	}
+	if !checkRuns {
+		return combined.SHA, statuses, nil
+	}
+
+	// API: GET /repos/{owner}/{repo}/commits/{ref}/check-runs
+	// Ask for the SHA instead of ref, in case ref moved in the meantime.
+	var runs struct {
+		CheckRuns []struct {
+			Name        string    `json:"name"`
+			Status      string    `json:"status"`
+			Conclusion  string    `json:"conclusion"`
+			DetailsURL  string    `json:"details_url"`
+			StartedAt   time.Time `json:"started_at"`
+			CompletedAt time.Time `json:"completed_at"`
+			Output      struct {
+				Title string `json:"title"`
+			} `json:"output"`
+		} `json:"check_runs"`
+	}
+	if err := gh.get(ctx, path.Join("commits", combined.SHA, "check-runs"),
+		&runs); err != nil {
+		return "", nil, err
+	}
+	for _, run := range runs.CheckRuns {
+		updatedAt := run.CompletedAt
+		if updatedAt.IsZero() {
+			updatedAt = run.StartedAt
+		}
+		statuses = append(statuses, ContextStatus{
+			Kind:        kindCheckRun,
+			Context:     run.Name,
+			State:       ghCheckRunState(run.Status, run.Conclusion),
+			Description: run.Output.Title,
+			TargetURL:   run.DetailsURL,
+			UpdatedAt:   updatedAt,
+		})
+	}
+
+	return combined.SHA, statuses, nil
+}
+
+// ghCheckRunState maps the status and conclusion of a check run to the states of the
+// GitHub Commit status API.
+// See https://docs.github.com/en/rest/checks/runs
+func ghCheckRunState(status, conclusion string) string {
+	if status != "completed" {
+		return "pending"
+	}
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return "success"
+	case "failure", "timed_out", "action_required":
+		return "failure"
+	default: // cancelled, stale
+		return "error"
+	}
+}
+
+// ghCombinedState returns the combined state of statuses, with the same rules as the
+// GitHub combined status: failure if any is error or failure, pending if there are none
+// or any is pending, success otherwise.
+// See https://docs.github.com/en/rest/commits/statuses#get-the-combined-status-for-a-specific-reference
+func ghCombinedState(statuses []ContextStatus) string {
+	state := "success"
+	if len(statuses) == 0 {
+		state = "pending"
+	}
+	for _, st := range statuses {
+		switch st.State {
+		case "error", "failure":
+			return "failure"
+		case "pending":
+			state = "pending"
+		}
+	}
+	return state
+}
+
+// get performs a GET on the API endpoint /repos/{owner}/{repo}/{apiPath} and JSON
+// decodes the reply into reply. Like [github.CommitStatus.Add], it retries on transient
+// errors and on rate limiting.
+func (gh ghClient) get(ctx context.Context, apiPath string, reply any) error {
+	theURL := gh.target.Server + path.Join("/repos", gh.owner, gh.repo, apiPath) +
+		"?" + url.Values{"per_page": {fmt.Sprint(ghPerPage)}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, theURL, nil)
+	if err != nil {
+		return fmt.Errorf("github: create http request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+gh.token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	var body []byte
+	workFn := func() (retry.Action, error) {
+		start := time.Now()
+		resp, err := gh.target.Client.Do(req)
+		if err != nil {
+			return retry.HardFail, fmt.Errorf("http client Do: %w", err)
+		}
+		defer resp.Body.Close()
+
+		gh.log.Debug("http-request", "method", req.Method, "url", req.URL,
+			"status", resp.StatusCode, "duration", time.Since(start),
+			"rate-limit-remaining", resp.Header.Get("X-RateLimit-Remaining"))
+
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return retry.HardFail, fmt.Errorf("reading body: %w", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return retry.Success, nil
+		}
+
+		ghErr := github.NewGitHubError(resp,
+			errors.New(strings.TrimSpace(string(body))))
+		if github.TransientError(resp.StatusCode) || github.RateLimited(ghErr) {
+			return retry.SoftFail, ghErr
+		}
+		return retry.HardFail, ghErr
+	}
+	if err := gh.target.Retry.Do(github.Backoff, workFn); err != nil {
+		if ghErr, ok := errors.AsType[github.GitHubError](err); ok {
+			return fmt.Errorf("github: GET %s: %d %s: %w", req.URL.Path,
+				ghErr.StatusCode, http.StatusText(ghErr.StatusCode), ghErr)
+		}
+		return fmt.Errorf("github: GET %s: %s", req.URL.Path, err)
+	}
+
+	if err := json.Unmarshal(body, reply); err != nil {
+		return fmt.Errorf("github: GET %s: decoding reply: %s", req.URL.Path, err)
+	}
+	return nil
+}
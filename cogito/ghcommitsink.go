@@ -2,21 +2,158 @@ package cogito
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"path"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/Pix4D/cogito/gitobj"
 	"github.com/Pix4D/go-kit/github"
 )
 
 // GitHubCommitStatusSink is an implementation of [Sinker] for the Cogito resource.
 type GitHubCommitStatusSink struct {
-	Log     *slog.Logger
+	Log      *slog.Logger
+	InputDir fs.FS
+	GitRef   string
+	Commit   *gitobj.Commit  // Nil if not available.
+	Build    *ConcourseBuild // Nil if not available.
+	// Repositories of source.repos, on which to set the commit status in addition to
+	// source.owner/repo at GitRef.
+	ExtraRepos []RepoCommit
+	Request    PutRequest
+}
+
+// RepoCommit is a commit of a repository of source.repos.
+type RepoCommit struct {
+	Owner   string
+	Repo    string
+	Context string // If empty, put param context.
 	GitRef  string
-	Request PutRequest
+}
+
+// ghMaxDescriptionLen is the maximum length of the description accepted by the
+// GitHub Commit status API.
+const ghMaxDescriptionLen = 140
+
+// ghStatus contains the parameters of a GitHub Commit status API request.
+type ghStatus struct {
+	owner       string
+	repo        string
+	sha         string
+	state       string
+	context     string
+	targetURL   string
+	description string
+}
+
+// prepare returns the commit statuses that Send would post.
+func (sink GitHubCommitStatusSink) prepare() ([]ghStatus, error) {
+	requests := ghStatusRequests(sink.Request)
+	statuses := make([]ghStatus, 0, len(requests)+len(sink.ExtraRepos))
+	for _, request := range requests {
+		status, err := sink.prepareOne(request, sink.GitRef, sink.Commit)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	// Put param statuses applies only to source.owner/repo. Each of the other
+	// repositories gets the status described by the top-level params.
+	for _, extra := range sink.ExtraRepos {
+		request := sink.Request
+		request.Source.Owner = extra.Owner
+		request.Source.Repo = extra.Repo
+		if extra.Context != "" {
+			request.Params.Context = extra.Context
+		}
+		request.Params.Statuses = nil
+		status, err := sink.prepareOne(request, extra.GitRef, nil)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// prepareOne returns the commit status for request, to set on gitRef.
+func (sink GitHubCommitStatusSink) prepareOne(request PutRequest, gitRef string,
+	commit *gitobj.Commit,
+) (ghStatus, error) {
+	params := request.Params
+	data := newTemplateData(request, gitRef, commit, sink.Build)
+
+	targetURL := concourseBuildURL(request.Env)
+	if request.Source.OmitTargetURL {
+		targetURL = ""
+	}
+	if params.TargetURL != "" {
+		targetURL = expandTemplateOrText(sink.Log, "target_url", params.TargetURL, data)
+	}
+
+	description, err := ghMakeDescription(sink.Log, sink.InputDir, request, data)
+	if err != nil {
+		return ghStatus{}, err
+	}
+	if utf8.RuneCountInString(description) > ghMaxDescriptionLen {
+		sink.Log.Warn("truncating description", "reason", "too long",
+			"length", utf8.RuneCountInString(description), "max", ghMaxDescriptionLen)
+		description = truncate(ghMaxDescriptionLen, description)
+	}
+
+	return ghStatus{
+		owner:       request.Source.Owner,
+		repo:        request.Source.Repo,
+		sha:         gitRef,
+		state:       ghAdaptState(params.State),
+		context:     ghMakeContext(request),
+		targetURL:   targetURL,
+		description: description,
+	}, nil
+}
+
+// Plan returns the requests to the GitHub Commit status API that Send would perform.
+func (sink GitHubCommitStatusSink) Plan() ([]SinkRequest, error) {
+	statuses, err := sink.prepare()
+	if err != nil {
+		return nil, fmt.Errorf("GitHubCommitStatusSink: %s", err)
+	}
+	src := sink.Request.Source
+
+	requests := make([]SinkRequest, 0, len(statuses))
+	for _, status := range statuses {
+		// API: POST /repos/{owner}/{repo}/statuses/{sha}
+		url := github.ApiRoot(src.GhHostname) +
+			path.Join("/repos", status.owner, status.repo, "statuses", status.sha)
+		body, err := json.Marshal(github.AddRequest{
+			State:       status.state,
+			TargetURL:   status.targetURL,
+			Description: status.description,
+			Context:     status.context,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GitHubCommitStatusSink: %s", err)
+		}
+		requests = append(requests, SinkRequest{
+			Sink:   "github",
+			Method: http.MethodPost,
+			URL:    url,
+			Body:   string(body),
+		})
+	}
+
+	return requests, nil
 }
 
 // Send sets the build status via the GitHub Commit status API endpoint.
+// If put param statuses is set, Send posts one commit status per element, reusing the
+// same authentication and stopping at the first error.
 func (sink GitHubCommitStatusSink) Send() error {
 	sink.Log.Debug("send: started")
 	defer sink.Log.Debug("send: finished")
@@ -26,9 +163,10 @@ func (sink GitHubCommitStatusSink) Send() error {
 
 	httpClient := &http.Client{}
 
-	ghState := ghAdaptState(sink.Request.Params.State)
-	buildURL := concourseBuildURL(sink.Request.Env)
-	context := ghMakeContext(sink.Request)
+	statuses, err := sink.prepare()
+	if err != nil {
+		return fmt.Errorf("GitHubCommitStatusSink: %s", err)
+	}
 	server := github.ApiRoot(sink.Request.Source.GhHostname)
 
 	token := sink.Request.Source.AccessToken
@@ -47,26 +185,51 @@ func (sink GitHubCommitStatusSink) Send() error {
 		Server: server,
 		Retry:  github.DefaultRetry(sink.Log),
 	}
-	commitStatus := github.NewCommitStatus(target, token,
-		sink.Request.Source.Owner, sink.Request.Source.Repo, context, sink.Log)
-	description := "Build " + sink.Request.Env.BuildName
+	for _, status := range statuses {
+		commitStatus := github.NewCommitStatus(target, token,
+			status.owner, status.repo, status.context, sink.Log)
 
-	sink.Log.Debug("posting to GitHub Commit Status API",
-		"state", ghState, "owner", sink.Request.Source.Owner,
-		"repo", sink.Request.Source.Repo, "git-ref", sink.GitRef,
-		"context", context, "buildURL", buildURL, "description", description)
-	if sink.Request.Source.OmitTargetURL {
-		buildURL = ""
-	}
-	if err := commitStatus.Add(ctx, sink.GitRef, ghState, buildURL, description); err != nil {
-		return err
+		sink.Log.Debug("posting to GitHub Commit Status API",
+			"state", status.state, "owner", status.owner,
+			"repo", status.repo, "git-ref", status.sha,
+			"context", status.context, "buildURL", status.targetURL,
+			"description", status.description)
+		if err := commitStatus.Add(ctx, status.sha, status.state, status.targetURL,
+			status.description); err != nil {
+			return err
+		}
+		sink.Log.Info("commit status posted successfully",
+			"state", status.state, "repo", status.owner+"/"+status.repo,
+			"git-ref", status.sha[0:9], "context", status.context)
 	}
-	sink.Log.Info("commit status posted successfully",
-		"state", ghState, "git-ref", sink.GitRef[0:9])
 
 	return nil
 }
 
+// ghStatusRequests returns one request per commit status to post. If put param statuses
+// is empty, it is the request itself. Otherwise, it is a copy of the request per element,
+// with the params of the element overriding the top-level ones.
+func ghStatusRequests(request PutRequest) []PutRequest {
+	if len(request.Params.Statuses) == 0 {
+		return []PutRequest{request}
+	}
+
+	requests := make([]PutRequest, 0, len(request.Params.Statuses))
+	for _, status := range request.Params.Statuses {
+		req := request
+		req.Params.Context = status.Context
+		if status.State != "" {
+			req.Params.State = status.State
+		}
+		req.Params.Description = status.Description
+		req.Params.DescriptionFile = ""
+		req.Params.TargetURL = status.TargetURL
+		req.Params.Statuses = nil
+		requests = append(requests, req)
+	}
+	return requests
+}
+
 // The states allowed by cogito are more than the states allowed by the GitHub Commit
 // status API. Adapt accordingly.
 func ghAdaptState(state BuildState) string {
@@ -76,6 +239,34 @@ func ghAdaptState(state BuildState) string {
 	return string(state)
 }
 
+// ghMakeDescription returns the "description" parameter of the GitHub Commit Status API,
+// based on the fields of request. The description from params.description_file,
+// if any, is appended to the one from params.description.
+func ghMakeDescription(log *slog.Logger, inputDir fs.FS, request PutRequest,
+	data TemplateData,
+) (string, error) {
+	params := request.Params
+	if params.Description == "" && params.DescriptionFile == "" {
+		return "Build " + request.Env.BuildName, nil
+	}
+
+	var parts []string
+	if params.Description != "" {
+		parts = append(parts,
+			expandTemplateOrText(log, "description", params.Description, data))
+	}
+	if params.DescriptionFile != "" {
+		contents, err := fs.ReadFile(inputDir, params.DescriptionFile)
+		if err != nil {
+			return "", fmt.Errorf("reading description_file: %s", err)
+		}
+		text := expandTemplateOrText(log, params.DescriptionFile, string(contents), data)
+		parts = append(parts, strings.TrimSpace(text))
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
 // ghMakeContext returns the "context" parameter of the GitHub Commit Status API, based
 // on the fields of request.
 func ghMakeContext(request PutRequest) string {
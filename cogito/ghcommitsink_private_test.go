@@ -1,9 +1,13 @@
 package cogito
 
 import (
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/testhelp"
 )
 
 func TestGhMakeContext(t *testing.T) {
@@ -89,3 +93,167 @@ func TestGhAdaptState(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
 	}
 }
+
+func TestGhMakeDescriptionSuccess(t *testing.T) {
+	type testCase struct {
+		name   string
+		params PutParams
+		want   string
+	}
+
+	inputDir := fstest.MapFS{
+		"out/description.txt": {Data: []byte("{{.Vars.issues}} issues\n")},
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{Params: tc.params, Env: Environment{BuildName: "42"}}
+		data := newTemplateData(request, "deadbeef", nil, nil)
+
+		have, err := ghMakeDescription(testhelp.MakeTestLog(), inputDir, request, data)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "default",
+			want: "Build 42",
+		},
+		{
+			name:   "description template",
+			params: PutParams{Description: "Build {{.BuildName}} on {{.ShortGitRef}}"},
+			want:   "Build 42 on deadbee",
+		},
+		{
+			name:   "not a template",
+			params: PutParams{Description: "{{ foo }} {{.Vars.missing}}"},
+			want:   "{{ foo }} {{.Vars.missing}}",
+		},
+		{
+			name: "description_file appended to description",
+			params: PutParams{
+				Description:     "lint:",
+				DescriptionFile: "out/description.txt",
+				Vars:            map[string]string{"issues": "12"},
+			},
+			want: "lint: 12 issues",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGhMakeDescriptionFailure(t *testing.T) {
+	request := PutRequest{Params: PutParams{DescriptionFile: "out/missing.txt"}}
+
+	_, err := ghMakeDescription(testhelp.MakeTestLog(), fstest.MapFS{}, request,
+		TemplateData{})
+
+	assert.Error(t, err,
+		"reading description_file: open out/missing.txt: file does not exist")
+}
+
+func TestGitHubCommitStatusSinkPrepareTruncatesDescription(t *testing.T) {
+	sink := GitHubCommitStatusSink{
+		Log:    testhelp.MakeTestLog(),
+		GitRef: "deadbeef",
+		Request: PutRequest{
+			Params: PutParams{
+				State:       StateFailure,
+				Description: strings.Repeat("x", 200),
+				TargetURL:   "https://example.com/{{.ShortGitRef}}",
+			},
+		},
+	}
+
+	have, err := sink.prepare()
+
+	assert.NilError(t, err)
+	assert.Equal(t, len(have), 1)
+	assert.Equal(t, len([]rune(have[0].description)), ghMaxDescriptionLen)
+	assert.Assert(t, strings.HasSuffix(have[0].description, "x…"))
+	assert.Equal(t, have[0].targetURL, "https://example.com/deadbee")
+}
+
+func TestGitHubCommitStatusSinkPrepareMultipleStatuses(t *testing.T) {
+	sink := GitHubCommitStatusSink{
+		Log:    testhelp.MakeTestLog(),
+		GitRef: "deadbeef",
+		Request: PutRequest{
+			Source: Source{ContextPrefix: "ci"},
+			Params: PutParams{
+				State:       StateSuccess,
+				Description: "top-level",
+				Statuses: []StatusParams{
+					{Context: "lint", State: StateFailure, Description: "12 issues"},
+					{Context: "unit", TargetURL: "https://example.com/{{.State}}"},
+				},
+			},
+			Env: Environment{BuildName: "42"},
+		},
+	}
+
+	have, err := sink.prepare()
+
+	assert.NilError(t, err)
+	want := []ghStatus{
+		{
+			sha:         "deadbeef",
+			state:       "failure",
+			context:     "ci/lint",
+			targetURL:   "/teams/pipelines/jobs/builds/42",
+			description: "12 issues",
+		},
+		{
+			sha:         "deadbeef",
+			state:       "success",
+			context:     "ci/unit",
+			targetURL:   "https://example.com/success",
+			description: "Build 42",
+		},
+	}
+	assert.Equal(t, len(have), len(want))
+	for i := range want {
+		assert.Equal(t, have[i], want[i])
+	}
+}
+
+func TestGitHubCommitStatusSinkPrepareExtraRepos(t *testing.T) {
+	sink := GitHubCommitStatusSink{
+		Log:    testhelp.MakeTestLog(),
+		GitRef: "deadbeef",
+		ExtraRepos: []RepoCommit{
+			{Owner: "the-owner", Repo: "the-lib", Context: "lib", GitRef: "c0ffee"},
+			{Owner: "the-owner", Repo: "the-tool", GitRef: "f00d"},
+		},
+		Request: PutRequest{
+			Source: Source{Owner: "the-owner", Repo: "the-repo"},
+			Params: PutParams{
+				State:    StateSuccess,
+				Context:  "build",
+				Statuses: []StatusParams{{Context: "lint"}, {Context: "unit"}},
+			},
+			Env: Environment{BuildName: "42"},
+		},
+	}
+
+	have, err := sink.prepare()
+
+	assert.NilError(t, err)
+	type repoStatus struct{ owner, repo, sha, context string }
+	want := []repoStatus{
+		{"the-owner", "the-repo", "deadbeef", "lint"},
+		{"the-owner", "the-repo", "deadbeef", "unit"},
+		{"the-owner", "the-lib", "c0ffee", "lib"},
+		{"the-owner", "the-tool", "f00d", "build"},
+	}
+	assert.Equal(t, len(have), len(want))
+	for i := range want {
+		assert.Equal(t,
+			repoStatus{have[i].owner, have[i].repo, have[i].sha, have[i].context},
+			want[i])
+	}
+}
@@ -104,6 +104,66 @@ func TestSinkGitHubCommitStatusSendGhAppSuccess(t *testing.T) {
 	assert.Equal(t, ghReq.Context, wantContext)
 }
 
+func TestSinkGitHubCommitStatusSendMultipleStatusesGhAppSuccess(t *testing.T) {
+	var tokenRequests int
+	var ghReqs []github.AddRequest
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() == "/app/installations/12345/access_tokens" {
+			tokenRequests++
+			w.WriteHeader(http.StatusCreated)
+			if _, err := fmt.Fprintln(w, `{"token": "dummy_installation_token"}`); err != nil {
+				t.Errorf("writing token: %s", err)
+			}
+			return
+		}
+		var ghReq github.AddRequest
+		if err := json.NewDecoder(r.Body).Decode(&ghReq); err != nil {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		ghReqs = append(ghReqs, ghReq)
+		w.WriteHeader(http.StatusCreated)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	gitHubSpyURL, err := url.Parse(ts.URL)
+	assert.NilError(t, err, "error parsing SpyHttpServer URL: %s", err)
+	privateKey := testhelp.GeneratePrivateKey(t, 2048)
+	sink := cogito.GitHubCommitStatusSink{
+		Log:    testhelp.MakeTestLog(),
+		GitRef: "deadbeefdeadbeef",
+		Request: cogito.PutRequest{
+			Source: cogito.Source{
+				GhHostname: gitHubSpyURL.Host,
+				GitHubApp: github.GitHubApp{
+					ClientId:       "client-id",
+					InstallationId: 12345,
+					PrivateKey:     string(testhelp.EncodePrivateKeyToPEM(privateKey)),
+				},
+			},
+			Params: cogito.PutParams{
+				State: cogito.StateSuccess,
+				Statuses: []cogito.StatusParams{
+					{Context: "lint", State: cogito.StateFailure},
+					{Context: "unit"},
+					{Context: "integration"},
+				},
+			},
+		},
+	}
+
+	err = sink.Send()
+
+	assert.NilError(t, err)
+	ts.Close() // Avoid races before the following asserts.
+	assert.Equal(t, tokenRequests, 1)
+	assert.Equal(t, len(ghReqs), 3)
+	assert.Equal(t, ghReqs[0].Context, "lint")
+	assert.Equal(t, ghReqs[0].State, "failure")
+	assert.Equal(t, ghReqs[2].Context, "integration")
+	assert.Equal(t, ghReqs[2].State, "success")
+}
+
 func TestSinkGitHubCommitStatusSendFailure(t *testing.T) {
 	ts := httptest.NewServer(
 		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
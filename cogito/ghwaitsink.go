@@ -0,0 +1,197 @@
+package cogito
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Pix4D/go-kit/github"
+)
+
+// GitHubWaitSink is an implementation of [Sinker] for put param action: wait. Instead of
+// setting a commit status, it waits for the commit statuses of the contexts of put
+// param wait_contexts to succeed.
+type GitHubWaitSink struct {
+	Log     *slog.Logger
+	GitRef  string
+	Request PutRequest
+	// Optional; used only to override in tests.
+	sleepFn func(d time.Duration)
+}
+
+const (
+	defaultWaitTimeout = 30 * time.Minute
+	// With an exponential backoff, the polling sequence is:
+	// 10s 20s 40s 80s 120s ... 120s, until reaching the timeout. Each poll costs one
+	// or two requests to the GitHub API; rate limiting is handled by [ghClient].
+	waitFirstDelay = 10 * time.Second
+	waitMaxDelay   = 2 * time.Minute
+)
+
+// Plan returns the requests to the GitHub API that a poll of Send would perform.
+func (sink GitHubWaitSink) Plan() ([]SinkRequest, error) {
+	src := sink.Request.Source
+	// API: GET /repos/{owner}/{repo}/commits/{ref}/status
+	apiPaths := []string{"status"}
+	if sink.Request.Params.WaitCheckRuns {
+		// API: GET /repos/{owner}/{repo}/commits/{ref}/check-runs
+		apiPaths = append(apiPaths, "check-runs")
+	}
+	requests := make([]SinkRequest, 0, len(apiPaths))
+	for _, apiPath := range apiPaths {
+		requests = append(requests, SinkRequest{
+			Sink:   "github",
+			Method: http.MethodGet,
+			URL: github.ApiRoot(src.GhHostname) +
+				path.Join("/repos", src.Owner, src.Repo, "commits", sink.GitRef, apiPath),
+		})
+	}
+	return requests, nil
+}
+
+// Send polls the commit statuses of GitRef, with exponential backoff, until all the
+// contexts of put param wait_contexts succeed, one of them fails, or put param
+// wait_timeout expires. On failure, the error contains a per-context report.
+func (sink GitHubWaitSink) Send() error {
+	sink.Log.Debug("send: started")
+	defer sink.Log.Debug("send: finished")
+
+	params := sink.Request.Params
+	timeout := defaultWaitTimeout
+	if params.WaitTimeout != "" {
+		// Already validated in LoadConfiguration.
+		timeout, _ = time.ParseDuration(params.WaitTimeout)
+	}
+	if sink.sleepFn == nil {
+		sink.sleepFn = time.Sleep
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	source := sink.Request.Source
+	gh, err := newGhClient(ctx, sink.Log, source)
+	if err != nil {
+		return fmt.Errorf("GitHubWaitSink: %s", err)
+	}
+	poll := func() ([]ContextStatus, error) {
+		_, statuses, err := gh.CommitStatuses(ctx, sink.GitRef, params.WaitCheckRuns)
+		ghErr, ok := errors.AsType[github.GitHubError](err)
+		if !ok || ghErr.StatusCode != http.StatusUnauthorized || source.AccessToken != "" {
+			return statuses, err
+		}
+		// The installation token of a GitHub app expires after one hour, while
+		// wait_timeout has no upper bound.
+		sink.Log.Info("GitHub app installation token rejected, getting a new one")
+		gh, err = newGhClient(ctx, sink.Log, source)
+		if err != nil {
+			return nil, err
+		}
+		_, statuses, err = gh.CommitStatuses(ctx, sink.GitRef, params.WaitCheckRuns)
+		return statuses, err
+	}
+
+	var report []waitResult
+	for delay := waitFirstDelay; ; delay = min(2*delay, waitMaxDelay) {
+		statuses, err := poll()
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && report != nil {
+				break
+			}
+			return fmt.Errorf("GitHubWaitSink: %s", err)
+		}
+		report = waitReport(params.WaitContexts, statuses)
+
+		switch waitOutcome(report) {
+		case "success":
+			sink.Log.Info("all contexts succeeded", "git-ref", sink.GitRef,
+				"contexts", params.WaitContexts, "elapsed", time.Since(start).Round(time.Second))
+			return nil
+		case "failure":
+			return fmt.Errorf("wait: commit %s: some contexts failed:\n%s",
+				sink.GitRef, formatWaitReport(report))
+		}
+
+		if time.Since(start)+delay > timeout {
+			break
+		}
+		sink.Log.Info("waiting", "git-ref", sink.GitRef, "delay", delay,
+			"pending", waitPending(report))
+		sink.sleepFn(delay)
+	}
+
+	return fmt.Errorf("wait: commit %s: timeout after %v:\n%s",
+		sink.GitRef, timeout, formatWaitReport(report))
+}
+
+// waitResult is the state of a context waited for. State "missing" means that the
+// context has not reported yet.
+type waitResult struct {
+	context   string
+	state     string
+	targetURL string
+}
+
+// waitReport returns the state of each of contexts. If a context has both a status and
+// a check run, the most recent wins.
+func waitReport(contexts []string, statuses []ContextStatus) []waitResult {
+	report := make([]waitResult, 0, len(contexts))
+	for _, context := range contexts {
+		result := waitResult{context: context, state: "missing"}
+		var latest time.Time
+		for _, st := range statuses {
+			if st.Context == context && !st.UpdatedAt.Before(latest) {
+				latest = st.UpdatedAt
+				result.state = st.State
+				result.targetURL = st.TargetURL
+			}
+		}
+		report = append(report, result)
+	}
+	return report
+}
+
+// waitOutcome returns "failure" if any context of report failed, "success" if all
+// succeeded, "pending" otherwise.
+func waitOutcome(report []waitResult) string {
+	outcome := "success"
+	for _, result := range report {
+		switch result.state {
+		case "error", "failure":
+			return "failure"
+		case "success":
+		default:
+			outcome = "pending"
+		}
+	}
+	return outcome
+}
+
+// waitPending returns the contexts of report that did not succeed yet.
+func waitPending(report []waitResult) []string {
+	var pending []string
+	for _, result := range report {
+		if result.state != "success" {
+			pending = append(pending, result.context)
+		}
+	}
+	return pending
+}
+
+// formatWaitReport renders report, one context per line.
+func formatWaitReport(report []waitResult) string {
+	lines := make([]string, 0, len(report))
+	for _, result := range report {
+		line := fmt.Sprintf("    %s: %s", result.context, result.state)
+		if result.targetURL != "" {
+			line += fmt.Sprintf(" (%s)", result.targetURL)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,197 @@
+package cogito
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/testhelp"
+	"github.com/Pix4D/go-kit/github"
+)
+
+func TestGitHubWaitSinkSendSuccess(t *testing.T) {
+	const sha = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	// One reply per poll; the last one is repeated.
+	replies := []string{
+		`{"statuses": []}`,
+		`{"statuses": [{"context": "lint", "state": "success"},
+                   {"context": "unit", "state": "pending"}]}`,
+		`{"statuses": [{"context": "lint", "state": "success"},
+                   {"context": "unit", "state": "success"},
+                   {"context": "other", "state": "failure"}]}`,
+	}
+	var polls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/the-owner/the-repo/commits/"+sha+"/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, replies[min(polls, len(replies)-1)])
+		polls++
+	}))
+	defer ts.Close()
+	var delays []time.Duration
+	sink := GitHubWaitSink{
+		Log:    testhelp.MakeTestLog(),
+		GitRef: sha,
+		Request: PutRequest{
+			Source: Source{
+				GhHostname: strings.TrimPrefix(ts.URL, "http://"),
+				Owner:      "the-owner", Repo: "the-repo", AccessToken: "the-token",
+			},
+			Params: PutParams{Action: ActionWait, WaitContexts: []string{"lint", "unit"}},
+		},
+		sleepFn: func(d time.Duration) { delays = append(delays, d) },
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	assert.Equal(t, polls, 3)
+	assert.DeepEqual(t, delays, []time.Duration{10 * time.Second, 20 * time.Second})
+}
+
+func TestGitHubWaitSinkSendGhAppTokenExpired(t *testing.T) {
+	const sha = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	var tokens, polls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app/installations/12345/access_tokens" {
+			tokens++
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": "token-%d"}`, tokens)
+			return
+		}
+		if r.URL.Path != "/repos/the-owner/the-repo/commits/"+sha+"/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		polls++
+		// The first token expires after the first poll.
+		if polls > 1 && r.Header.Get("Authorization") == "token token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "Bad credentials"}`)
+			return
+		}
+		if polls == 1 {
+			fmt.Fprint(w, `{"statuses": [{"context": "unit", "state": "pending"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"statuses": [{"context": "unit", "state": "success"}]}`)
+	}))
+	defer ts.Close()
+	privateKey := testhelp.GeneratePrivateKey(t, 2048)
+	sink := GitHubWaitSink{
+		Log:    testhelp.MakeTestLog(),
+		GitRef: sha,
+		Request: PutRequest{
+			Source: Source{
+				GhHostname: strings.TrimPrefix(ts.URL, "http://"),
+				Owner:      "the-owner", Repo: "the-repo",
+				GitHubApp: github.GitHubApp{
+					ClientId:       "client-id",
+					InstallationId: 12345,
+					PrivateKey:     string(testhelp.EncodePrivateKeyToPEM(privateKey)),
+				},
+			},
+			Params: PutParams{Action: ActionWait, WaitContexts: []string{"unit"}},
+		},
+		sleepFn: func(d time.Duration) {},
+	}
+
+	err := sink.Send()
+
+	assert.NilError(t, err)
+	assert.Equal(t, tokens, 2)
+	assert.Equal(t, polls, 3)
+}
+
+func TestGitHubWaitSinkSendFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		reply   string
+		timeout string
+		wantErr string
+	}
+
+	const sha = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+
+	test := func(t *testing.T, tc testCase) {
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, tc.reply) }))
+		defer ts.Close()
+		sink := GitHubWaitSink{
+			Log:    testhelp.MakeTestLog(),
+			GitRef: sha,
+			Request: PutRequest{
+				Source: Source{
+					GhHostname: strings.TrimPrefix(ts.URL, "http://"),
+					Owner:      "the-owner", Repo: "the-repo", AccessToken: "the-token",
+				},
+				Params: PutParams{
+					Action:       ActionWait,
+					WaitContexts: []string{"lint", "unit", "e2e"},
+					WaitTimeout:  tc.timeout,
+				},
+			},
+			sleepFn: func(time.Duration) {},
+		}
+
+		err := sink.Send()
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name: "a context failed: no need to wait for the others",
+			reply: `{"statuses": [
+  {"context": "lint", "state": "success"},
+  {"context": "unit", "state": "failure", "target_url": "https://ci.example.org/unit"}]}`,
+			wantErr: `wait: commit af6cd86e98eb1485f04d38b78d9532e916bbff02: some contexts failed:
+    lint: success
+    unit: failure (https://ci.example.org/unit)
+    e2e: missing`,
+		},
+		{
+			name: "timeout",
+			reply: `{"statuses": [
+  {"context": "lint", "state": "success"},
+  {"context": "unit", "state": "pending"}]}`,
+			timeout: "25s",
+			wantErr: `wait: commit af6cd86e98eb1485f04d38b78d9532e916bbff02: timeout after 25s:
+    lint: success
+    unit: pending
+    e2e: missing`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestWaitReport(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	statuses := []ContextStatus{
+		{Kind: kindStatus, Context: "lint", State: "failure", UpdatedAt: t0},
+		{Kind: kindCheckRun, Context: "lint", State: "success", UpdatedAt: t0.Add(time.Minute)},
+		{Kind: kindStatus, Context: "unit", State: "pending", UpdatedAt: t0},
+	}
+
+	have := waitReport([]string{"lint", "unit", "e2e"}, statuses)
+
+	want := []waitResult{
+		{context: "lint", state: "success"},
+		{context: "unit", state: "pending"},
+		{context: "e2e", state: "missing"},
+	}
+	assert.Assert(t, slices.Equal(have, want), "have: %v, want: %v", have, want)
+	assert.Equal(t, waitOutcome(have), "pending")
+	assert.DeepEqual(t, waitPending(have), []string{"unit", "e2e"})
+}
@@ -0,0 +1,187 @@
+package cogito
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Pix4D/cogito/gitobj"
+)
+
+// gitDirs returns the git directory and the common git directory of the repository
+// with working tree repoPath.
+//
+// Usually both are repoPath/.git. If the repository is a linked worktree or a
+// submodule, repoPath/.git is a file of the form "gitdir: <path>", pointing to the
+// git directory. In case of a linked worktree, the git directory contains in turn a
+// file "commondir", pointing to the directory shared by all the worktrees, which
+// contains the config, the refs and the objects.
+func gitDirs(repoPath string) (gitDir, commonDir string, err error) {
+	gitDir = filepath.Join(repoPath, ".git")
+	fi, err := os.Stat(gitDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", fmt.Errorf("git dir: %w", err)
+	}
+	// If .git does not exist, let the caller report the missing file it needs.
+	if err == nil && !fi.IsDir() {
+		buf, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", "", fmt.Errorf("git dir: %w", err)
+		}
+		line := strings.TrimSpace(string(buf))
+		target, found := strings.CutPrefix(line, "gitdir: ")
+		if !found {
+			return "", "", fmt.Errorf("git dir: invalid .git file format: %q", line)
+		}
+		gitDir = resolvePath(repoPath, target)
+	}
+
+	commonDir = gitDir
+	buf, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err == nil {
+		commonDir = resolvePath(gitDir, strings.TrimSpace(string(buf)))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", "", fmt.Errorf("git dir: %w", err)
+	}
+
+	return gitDir, commonDir, nil
+}
+
+// resolvePath returns path if absolute, otherwise path relative to dir.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// resolveRef returns the commit SHA pointed to by refName (for example
+// "refs/heads/main"). The ref is looked up as a loose ref, first in gitDir (refs
+// specific to a worktree) then in commonDir, and finally in commonDir/packed-refs.
+// Loose refs take precedence over packed refs, as git does.
+func resolveRef(gitDir, commonDir, refName string) (string, error) {
+	for _, dir := range []string{gitDir, commonDir} {
+		buf, err := os.ReadFile(filepath.Join(dir, refName))
+		if err == nil {
+			return strings.TrimSpace(string(buf)), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("read SHA file: %w", err)
+		}
+	}
+
+	sha, err := lookupPackedRef(filepath.Join(commonDir, "packed-refs"), refName)
+	if err != nil {
+		return "", err
+	}
+	if sha == "" {
+		return "", fmt.Errorf("ref %s: not found (neither loose nor packed)", refName)
+	}
+	return sha, nil
+}
+
+// lookupPackedRef returns the commit SHA of refName in the packed-refs file at path,
+// or the empty string if not found. A missing packed-refs file is not an error.
+//
+// The packed-refs file has the format:
+//
+//	# pack-refs with: peeled fully-peeled sorted
+//	af6cd86e98eb1485f04d38b78d9532e916bbff02 refs/heads/main
+//	5e4e1b1a8c8e8d3f6a8f8b0f2c3d4e5f6a7b8c9d refs/tags/v1.0.0
+//	^af6cd86e98eb1485f04d38b78d9532e916bbff02
+//
+// where a line starting with ^ is the commit pointed to by the annotated tag above.
+func lookupPackedRef(path, refName string) (string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read packed-refs: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		sha, name, found := strings.Cut(line, " ")
+		if found && name == refName {
+			return sha, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read packed-refs: %w", err)
+	}
+	return "", nil
+}
+
+// readResourceRef returns the commit SHA stored by the Concourse git resource in file
+// .git/ref, or the empty string if the file does not exist.
+//
+// The file contains the SHA of the fetched version, optionally followed by the name of
+// the tag, if the git resource is configured with a tag filter. For example:
+//
+//	af6cd86e98eb1485f04d38b78d9532e916bbff02 v1.2.3
+func readResourceRef(gitDir string) (string, error) {
+	buf, err := os.ReadFile(filepath.Join(gitDir, "ref"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read .git/ref: %w", err)
+	}
+	fields := strings.Fields(string(buf))
+	if len(fields) == 0 || !isGitSHA(fields[0]) {
+		return "", fmt.Errorf("invalid .git/ref format: %q", strings.TrimSpace(string(buf)))
+	}
+	return fields[0], nil
+}
+
+// readGitBranch returns the name of the branch checked out in the repository with
+// working tree repoPath, or the empty string if HEAD is detached.
+func readGitBranch(repoPath string) (string, error) {
+	gitDir, _, err := gitDirs(repoPath)
+	if err != nil {
+		return "", err
+	}
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", fmt.Errorf("git branch: %w", err)
+	}
+	ref, found := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+	if !found {
+		return "", nil
+	}
+	return ref, nil
+}
+
+// readGitCommit returns the commit gitRef of the repository with working tree repoPath.
+func readGitCommit(repoPath, gitRef string) (gitobj.Commit, error) {
+	_, commonDir, err := gitDirs(repoPath)
+	if err != nil {
+		return gitobj.Commit{}, err
+	}
+	reader := gitobj.NewReader(filepath.Join(commonDir, "objects"))
+	defer reader.Close()
+	return reader.ReadCommit(gitRef)
+}
+
+// isGitSHA reports whether s is a full SHA-1 or SHA-256 object name.
+func isGitSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
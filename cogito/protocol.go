@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Pix4D/go-kit/github"
 	"github.com/Pix4D/go-kit/sets"
@@ -18,7 +20,7 @@ import (
 
 var hostnameRegexp = regexp.MustCompile(`^(?P<host>[a-zA-Z0-9.-]+)(?::(?P<port>\d+))?$`)
 
-// DummyVersion is the version always returned by the Cogito resource.
+// DummyVersion is the version returned by the check step, unless in watch mode.
 // DO NOT REASSIGN!
 var DummyVersion = Version{Ref: "dummy"}
 
@@ -116,6 +118,9 @@ func NewPutRequest(input []byte) (PutRequest, error) {
 	if err := request.Source.Validate(); err != nil {
 		return PutRequest{}, fmt.Errorf("put: %s", err)
 	}
+	if err := request.Source.readSecretEnvs(); err != nil {
+		return PutRequest{}, fmt.Errorf("put: source: %s", err)
+	}
 
 	request.Env.Fill()
 
@@ -140,6 +145,8 @@ func (req *PutRequest) UnmarshalJSON(data []byte) error {
 	aux2 := request{
 		Params: PutParams{
 			ChatAppendSummary: req.Source.ChatAppendSummary, // default value
+			DryRun:            req.Source.DryRun,            // default value
+			GChatFormat:       req.Source.GChatFormat,       // default value
 		},
 	}
 	// Since we also want to enforce the parser to fail if it encounters unknown fields,
@@ -183,6 +190,88 @@ type Source struct {
 	ChatAppendSummary  bool         `json:"chat_append_summary"`
 	ChatNotifyOnStates []BuildState `json:"chat_notify_on_states"`
 	Sinks              []string     `json:"sinks"`
+	DryRun             bool         `json:"dry_run"`
+	Repos              []RepoSource `json:"repos"`
+	GitRemote          string       `json:"git_remote"` // Default: origin.
+	GitURLRewrites     []URLRewrite `json:"git_url_rewrites"`
+	WatchBranch        string       `json:"watch_branch"`
+	WatchContexts      []string     `json:"watch_contexts"`
+	WatchCheckRuns     bool         `json:"watch_check_runs"`
+	ConcourseURL       string       `json:"concourse_url"`   // Default: ATC_EXTERNAL_URL.
+	ConcourseToken     string       `json:"concourse_token"` // SENSITIVE
+	ChatLogLines       int          `json:"chat_log_lines"`
+	// ChatNotifyOnTransitions, if set, changes the default of ChatNotifyOnStates to empty.
+	ChatNotifyOnTransitions []Transition `json:"chat_notify_on_transitions"`
+	ChatUpdateInPlace       bool         `json:"chat_update_in_place"`
+	GChatFormat             string       `json:"gchat_format"`     // Default: text.
+	ChatThreadMode          string       `json:"chat_thread_mode"` // Default: thread.
+	// ChatThreadKey is a template. Default: pipeline name and commit SHA.
+	ChatThreadKey string `json:"chat_thread_key"`
+	// ChatMentions maps the email of a commit author to a chat user ID (users/<id>).
+	ChatMentions    map[string]string `json:"chat_mentions"`
+	ChatQuietHours  []QuietHours      `json:"chat_quiet_hours"`
+	ChatMinInterval string            `json:"chat_min_interval"` // Per job, for example 30m.
+	// Routes, if set, replace GChatWebHook.
+	Routes []Route `json:"routes"`
+	// Alternatives to the inline secrets. A _file key is a path in the put inputs, an
+	// _env key is the name of an environment variable.
+	AccessTokenFile         string `json:"access_token_file"`
+	AccessTokenEnv          string `json:"access_token_env"`
+	GChatWebHookFile        string `json:"gchat_webhook_file"`
+	GChatWebHookEnv         string `json:"gchat_webhook_env"`
+	GitHubAppPrivateKeyFile string `json:"github_app_private_key_file"`
+	GitHubAppPrivateKeyEnv  string `json:"github_app_private_key_env"`
+}
+
+// RepoSource is an element of the source key "repos": a GitHub repository, in addition
+// to owner/repo, on which to set the commit status if it is in the put inputs.
+type RepoSource struct {
+	//
+	// Mandatory
+	//
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	//
+	// Optional
+	//
+	Context string `json:"context"` // Default: put param context.
+}
+
+// URLRewrite is an element of the source key "git_url_rewrites": a rule to map the URL
+// of the git remote of an input repository (for example a mirror behind a git proxy)
+// to the canonical GitHub URL, in the spirit of the git configuration
+// url.<base>.insteadOf. If the remote URL starts with From, From is replaced by To.
+type URLRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// QuietHours is an element of the source key "chat_quiet_hours": a daily time window
+// during which only the chat messages for AllowStates are sent. If End is before
+// Start, the window spans midnight.
+type QuietHours struct {
+	Start       string       `json:"start"`     // HH:MM, included.
+	End         string       `json:"end"`       // HH:MM, excluded.
+	TimeZone    string       `json:"time_zone"` // IANA name, such as Europe/Zurich. Default: UTC.
+	AllowStates []BuildState `json:"allow_states"`
+}
+
+// Route is an element of the source key "routes": the destination of the chat message,
+// if the build matches. An empty match key matches everything.
+type Route struct {
+	//
+	// Match
+	//
+	States       []BuildState      `json:"states"`    // Default: source.chat_notify_on_states.
+	Jobs         []string          `json:"jobs"`      // Globs, see [path.Match].
+	Pipelines    []string          `json:"pipelines"` // Globs, see [path.Match].
+	InstanceVars map[string]string `json:"instance_vars"`
+	Branches     []string          `json:"branches"` // Globs, see [path.Match].
+	//
+	// Destination
+	//
+	Sink    string `json:"sink"`    // Default: gchat.
+	WebHook string `json:"webhook"` // SENSITIVE
 }
 
 // LogValue implements slog.LogValuer.
@@ -204,6 +293,31 @@ func (src Source) LogValue() slog.Value {
 		slog.Bool("chat_append_summary", src.ChatAppendSummary),
 		slog.String("chat_notify_on_states", fmt.Sprint(src.ChatNotifyOnStates)),
 		slog.String("sinks:", strings.Join(src.Sinks, ",")),
+		slog.Bool("dry_run", src.DryRun),
+		slog.String("repos", fmt.Sprint(src.Repos)),
+		slog.String("git_remote", src.GitRemote),
+		slog.String("git_url_rewrites", fmt.Sprint(src.GitURLRewrites)),
+		slog.String("watch_branch", src.WatchBranch),
+		slog.String("watch_contexts", strings.Join(src.WatchContexts, ",")),
+		slog.Bool("watch_check_runs", src.WatchCheckRuns),
+		slog.String("concourse_url", src.ConcourseURL),
+		slog.String("concourse_token", redact(src.ConcourseToken)),
+		slog.Int("chat_log_lines", src.ChatLogLines),
+		slog.String("chat_notify_on_transitions", fmt.Sprint(src.ChatNotifyOnTransitions)),
+		slog.Bool("chat_update_in_place", src.ChatUpdateInPlace),
+		slog.String("gchat_format", src.GChatFormat),
+		slog.String("chat_thread_mode", src.ChatThreadMode),
+		slog.String("chat_thread_key", src.ChatThreadKey),
+		slog.String("chat_mentions", fmt.Sprint(src.ChatMentions)),
+		slog.String("chat_quiet_hours", fmt.Sprint(src.ChatQuietHours)),
+		slog.String("chat_min_interval", src.ChatMinInterval),
+		slog.String("routes", fmt.Sprint(src.Routes)),
+		slog.String("access_token_file", src.AccessTokenFile),
+		slog.String("access_token_env", src.AccessTokenEnv),
+		slog.String("gchat_webhook_file", src.GChatWebHookFile),
+		slog.String("gchat_webhook_env", src.GChatWebHookEnv),
+		slog.String("github_app_private_key_file", src.GitHubAppPrivateKeyFile),
+		slog.String("github_app_private_key_env", src.GitHubAppPrivateKeyEnv),
 	)
 }
 
@@ -269,15 +383,27 @@ func (src *Source) Validate() error {
 		return fmt.Errorf("source: invalid sink(s): %w", err)
 	}
 
+	if err := src.validateSecretKeys(); err != nil {
+		return fmt.Errorf("source: %s", err)
+	}
+	// A secret can also be set with its _file or _env variant.
+	hasAccessToken := src.AccessToken != "" || src.AccessTokenFile != "" ||
+		src.AccessTokenEnv != ""
+	hasWebHook := src.GChatWebHook != "" || src.GChatWebHookFile != "" ||
+		src.GChatWebHookEnv != ""
+	hasPrivateKey := src.GitHubApp.PrivateKey != "" || src.GitHubAppPrivateKeyFile != "" ||
+		src.GitHubAppPrivateKeyEnv != ""
+	hasGitHubApp := !src.GitHubApp.IsZero() || hasPrivateKey
+
 	sinks := sets.From(src.Sinks...)
 	if sinks.Size() == 0 || sinks.Contains("github") {
 		// Cogito commit Github status mandatory fields.
-		if !src.GitHubApp.IsZero() && src.AccessToken != "" {
+		if hasGitHubApp && hasAccessToken {
 			return fmt.Errorf("source: cannot specify both github_app and access_token")
 		}
 
 		// either access_token or github_app must be specified
-		if src.AccessToken == "" && src.GitHubApp.IsZero() {
+		if !hasAccessToken && !hasGitHubApp {
 			return fmt.Errorf("source: one of access_token or github_app must be specified")
 		}
 
@@ -288,14 +414,14 @@ func (src *Source) Validate() error {
 			mandatory = append(mandatory, "repo")
 		}
 
-		if !src.GitHubApp.IsZero() {
+		if hasGitHubApp {
 			if src.GitHubApp.ClientId == "" {
 				mandatory = append(mandatory, "github_app.client_id")
 			}
 			if src.GitHubApp.InstallationId == 0 {
 				mandatory = append(mandatory, "github_app.installation_id")
 			}
-			if src.GitHubApp.PrivateKey == "" {
+			if !hasPrivateKey {
 				mandatory = append(mandatory, "github_app.private_key")
 			}
 		}
@@ -303,7 +429,7 @@ func (src *Source) Validate() error {
 
 	if sinks.Contains("gchat") {
 		// Gchat is explicitly required so makes its setting mandatory.
-		if src.GChatWebHook == "" {
+		if !hasWebHook && len(src.Routes) == 0 {
 			mandatory = append(mandatory, "gchat_webhook")
 		}
 	}
@@ -315,7 +441,111 @@ func (src *Source) Validate() error {
 	//
 	// Validate optional fields.
 	//
-	// In this case, nothing to validate.
+	for i, repo := range src.Repos {
+		if repo.Owner == "" || repo.Repo == "" {
+			return fmt.Errorf("source: repos[%d]: missing keys: owner, repo", i)
+		}
+		if sameRepo(repo.Owner, repo.Repo, src.Owner, src.Repo) {
+			return fmt.Errorf("source: repos[%d]: duplicate of owner/repo: %s/%s",
+				i, repo.Owner, repo.Repo)
+		}
+		for j := range i {
+			if sameRepo(repo.Owner, repo.Repo, src.Repos[j].Owner, src.Repos[j].Repo) {
+				return fmt.Errorf("source: repos[%d]: duplicate of repos[%d]: %s/%s",
+					i, j, repo.Owner, repo.Repo)
+			}
+		}
+	}
+
+	if strings.ContainsAny(src.GitRemote, "\" \t\n") {
+		return fmt.Errorf("source: git_remote: invalid remote name: %q", src.GitRemote)
+	}
+	for i, rw := range src.GitURLRewrites {
+		if rw.From == "" || rw.To == "" {
+			return fmt.Errorf("source: git_url_rewrites[%d]: missing keys: from, to", i)
+		}
+	}
+
+	if src.WatchBranch == "" && (len(src.WatchContexts) > 0 || src.WatchCheckRuns) {
+		return fmt.Errorf("source: watch_contexts and watch_check_runs require watch_branch")
+	}
+	if src.WatchBranch != "" && !(sinks.Size() == 0 || sinks.Contains("github")) {
+		return fmt.Errorf("source: watch_branch requires sink github")
+	}
+
+	if src.ConcourseURL != "" {
+		if src.ConcourseToken == "" {
+			return fmt.Errorf("source: concourse_url requires concourse_token")
+		}
+		theURL, err := url.Parse(src.ConcourseURL)
+		if err != nil || (theURL.Scheme != "http" && theURL.Scheme != "https") ||
+			theURL.Host == "" {
+			return fmt.Errorf("source: concourse_url: want http(s) URL, have: %q",
+				src.ConcourseURL)
+		}
+	}
+	if src.ChatLogLines < 0 {
+		return fmt.Errorf("source: chat_log_lines: want positive number, have: %d",
+			src.ChatLogLines)
+	}
+	if src.ChatLogLines > 0 && src.ConcourseToken == "" {
+		return fmt.Errorf("source: chat_log_lines requires concourse_token")
+	}
+	if err := validateGChatFormat(src.GChatFormat); err != nil {
+		return fmt.Errorf("source: %s", err)
+	}
+	if err := validateChatThreadMode(src.ChatThreadMode); err != nil {
+		return fmt.Errorf("source: %s", err)
+	}
+	if src.ChatThreadKey != "" {
+		if src.ChatThreadMode != "" && src.ChatThreadMode != ChatThreadModeThread {
+			return fmt.Errorf("source: chat_thread_key requires chat_thread_mode: %s",
+				ChatThreadModeThread)
+		}
+		if _, err := parseTemplate("chat_thread_key", src.ChatThreadKey); err != nil {
+			return fmt.Errorf("source: %s", err)
+		}
+	}
+	if err := validateChatMentions(src.ChatMentions); err != nil {
+		return fmt.Errorf("source: chat_mentions: %s", err)
+	}
+	if len(src.Routes) > 0 {
+		if hasWebHook {
+			return fmt.Errorf("source: routes and gchat_webhook are mutually exclusive")
+		}
+		if !(sinks.Size() == 0 || sinks.Contains("gchat")) {
+			return fmt.Errorf("source: routes requires sink gchat")
+		}
+	}
+	for i, route := range src.Routes {
+		if err := route.validate(); err != nil {
+			return fmt.Errorf("source: routes[%d]: %s", i, err)
+		}
+	}
+	for i, qh := range src.ChatQuietHours {
+		if err := qh.validate(); err != nil {
+			return fmt.Errorf("source: chat_quiet_hours[%d]: %s", i, err)
+		}
+	}
+	if src.ChatMinInterval != "" {
+		if interval, err := time.ParseDuration(src.ChatMinInterval); err != nil ||
+			interval <= 0 {
+			return fmt.Errorf(
+				"source: chat_min_interval: want positive duration (for example 30m), have: %q",
+				src.ChatMinInterval)
+		}
+		// The time of the last chat message is in the versions of the previous builds.
+		if src.ConcourseToken == "" {
+			return fmt.Errorf("source: chat_min_interval requires concourse_token")
+		}
+	}
+	// To find the state of the previous build, we need either the Concourse API or the
+	// commit status of the parent commit on GitHub.
+	if len(src.ChatNotifyOnTransitions) > 0 && src.ConcourseToken == "" &&
+		!(sinks.Size() == 0 || sinks.Contains("github")) {
+		return fmt.Errorf(
+			"source: chat_notify_on_transitions requires concourse_token or sink github")
+	}
 
 	//
 	// Apply defaults.
@@ -323,7 +553,7 @@ func (src *Source) Validate() error {
 	if src.LogLevel == "" {
 		src.LogLevel = "info"
 	}
-	if len(src.ChatNotifyOnStates) == 0 {
+	if len(src.ChatNotifyOnStates) == 0 && len(src.ChatNotifyOnTransitions) == 0 {
 		src.ChatNotifyOnStates = defaultNotifyStates
 	}
 	if src.GhHostname == "" {
@@ -347,14 +577,45 @@ func redact(s string) string {
 
 // Version is a JSON object part of the Concourse resource protocol. The only requirement
 // is that the fields must be of type string, but the keys can be anything.
-// For Cogito, we have one key, "ref".
+// For Cogito, we have key "ref" and, depending on the step, also other keys:
+//   - check, only if source.watch_branch is set: "context" and "state". The version is
+//     the state of a context on the commit with SHA ref.
+//   - put: "context", "state" and "time". The version is what put posted on the
+//     commit with SHA ref (or "dummy" if none), and when. Key "context" contains the
+//     comma-separated contexts.
 type Version struct {
-	Ref string `json:"ref"`
+	Ref     string `json:"ref"`
+	Context string `json:"context,omitempty"`
+	State   string `json:"state,omitempty"`
+	Time    string `json:"time,omitempty"` // RFC 3339, UTC.
+	// When the put sent a chat message, the same as Time; used by source key
+	// chat_min_interval. Empty if no message was sent.
+	ChatTime string `json:"chat_time,omitempty"`
+	// The commit statuses posted on source.repos, comma-separated, each of the form
+	// owner/repo@sha:context.
+	Repos string `json:"repos,omitempty"`
 }
 
 // String renders Version.
 func (ver Version) String() string {
-	return fmt.Sprint("ref: ", ver.Ref)
+	var bld strings.Builder
+	fmt.Fprint(&bld, "ref: ", ver.Ref)
+	if ver.Context != "" {
+		fmt.Fprint(&bld, ", context: ", ver.Context)
+	}
+	if ver.State != "" {
+		fmt.Fprint(&bld, ", state: ", ver.State)
+	}
+	if ver.Time != "" {
+		fmt.Fprint(&bld, ", time: ", ver.Time)
+	}
+	if ver.ChatTime != "" {
+		fmt.Fprint(&bld, ", chat_time: ", ver.ChatTime)
+	}
+	if ver.Repos != "" {
+		fmt.Fprint(&bld, ", repos: ", ver.Repos)
+	}
+	return bld.String()
 }
 
 // Output is the JSON object emitted by the get and put step.
@@ -391,7 +652,10 @@ const (
 	StateSuccess BuildState = "success"
 )
 
-const KeyState = "state"
+const (
+	KeyState  = "state"
+	KeyDryRun = "dry_run"
+)
 
 func (bs *BuildState) UnmarshalJSON(data []byte) error {
 	var str string
@@ -422,12 +686,46 @@ type PutParams struct {
 	//
 	// Optional
 	//
-	Context           string   `json:"context"`
-	ChatMessage       string   `json:"chat_message"`
-	ChatMessageFile   string   `json:"chat_message_file"`
-	ChatAppendSummary bool     `json:"chat_append_summary"`
-	GChatWebHook      string   `json:"gchat_webhook"` // SENSITIVE
-	Sinks             []string `json:"sinks"`
+	Context           string            `json:"context"`
+	Description       string            `json:"description"`
+	DescriptionFile   string            `json:"description_file"`
+	TargetURL         string            `json:"target_url"`
+	ChatMessage       string            `json:"chat_message"`
+	ChatMessageFile   string            `json:"chat_message_file"`
+	ChatAppendSummary bool              `json:"chat_append_summary"`
+	GChatWebHook      string            `json:"gchat_webhook"` // SENSITIVE
+	Sinks             []string          `json:"sinks"`
+	DryRun            bool              `json:"dry_run"`
+	Vars              map[string]string `json:"vars"`
+	Statuses          []StatusParams    `json:"statuses"`
+	StatusesFile      string            `json:"statuses_file"`
+	Commit            string            `json:"commit"`
+	CommitFile        string            `json:"commit_file"`
+	Action            string            `json:"action"` // Default: set the status.
+	WaitContexts      []string          `json:"wait_contexts"`
+	WaitTimeout       string            `json:"wait_timeout"` // Default: 30m.
+	WaitCheckRuns     bool              `json:"wait_check_runs"`
+	GChatFormat       string            `json:"gchat_format"` // Default: source.gchat_format.
+	ChatMentionsFile  string            `json:"chat_mentions_file"`
+}
+
+// ActionWait is the value of put param "action" to wait for the commit statuses of
+// the contexts of put param "wait_contexts" to succeed, instead of setting the status.
+const ActionWait = "wait"
+
+// StatusParams is an element of the put param "statuses": a GitHub commit status to
+// post in addition to the others in the same put step.
+type StatusParams struct {
+	//
+	// Mandatory
+	//
+	Context string `json:"context"`
+	//
+	// Optional
+	//
+	State       BuildState `json:"state,omitempty"` // Default: PutParams.State
+	Description string     `json:"description"`
+	TargetURL   string     `json:"target_url"`
 }
 
 // LogValue implements slog.LogValuer.
@@ -437,11 +735,26 @@ func (params PutParams) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.String("state", string(params.State)),
 		slog.String("context", params.Context),
+		slog.String("description", params.Description),
+		slog.String("description_file", params.DescriptionFile),
+		slog.String("target_url", params.TargetURL),
 		slog.String("chat_message", params.ChatMessage),
 		slog.String("chat_message_file", params.ChatMessageFile),
 		slog.Bool("chat_append_summary", params.ChatAppendSummary),
 		slog.String("gchat_webhook", redact(params.GChatWebHook)),
 		slog.String("sinks", strings.Join(params.Sinks, ",")),
+		slog.Bool("dry_run", params.DryRun),
+		slog.String("vars", fmt.Sprint(params.Vars)),
+		slog.String("statuses", fmt.Sprint(params.Statuses)),
+		slog.String("statuses_file", params.StatusesFile),
+		slog.String("commit", params.Commit),
+		slog.String("commit_file", params.CommitFile),
+		slog.String("action", params.Action),
+		slog.String("wait_contexts", strings.Join(params.WaitContexts, ",")),
+		slog.String("wait_timeout", params.WaitTimeout),
+		slog.Bool("wait_check_runs", params.WaitCheckRuns),
+		slog.String("gchat_format", params.GChatFormat),
+		slog.String("chat_mentions_file", params.ChatMentionsFile),
 	)
 }
 
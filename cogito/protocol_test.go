@@ -64,6 +64,50 @@ func TestSourceValidationSuccess(t *testing.T) {
 				return source
 			},
 		},
+		{
+			name: "routes instead of gchat_webhook",
+			mkSource: func() cogito.Source {
+				return cogito.Source{
+					Sinks: []string{"gchat"},
+					Routes: []cogito.Route{
+						{Branches: []string{"main"}, WebHook: "the-webhook"},
+					},
+				}
+			},
+		},
+		{
+			name: "access_token_file instead of access_token",
+			mkSource: func() cogito.Source {
+				return cogito.Source{
+					Owner:           "the-owner",
+					Repo:            "the-repo",
+					AccessTokenFile: "secrets/token",
+				}
+			},
+		},
+		{
+			name: "gchat_webhook_env instead of gchat_webhook",
+			mkSource: func() cogito.Source {
+				return cogito.Source{
+					Sinks:           []string{"gchat"},
+					GChatWebHookEnv: "THE_WEBHOOK",
+				}
+			},
+		},
+		{
+			name: "github_app_private_key_file instead of github_app.private_key",
+			mkSource: func() cogito.Source {
+				return cogito.Source{
+					Owner: "the-owner",
+					Repo:  "the-repo",
+					GitHubApp: github.GitHubApp{
+						ClientId:       "client-id-key",
+						InstallationId: 12345,
+					},
+					GitHubAppPrivateKeyFile: "secrets/private-key.pem",
+				}
+			},
+		},
 		{
 			name: "git source: github app",
 			mkSource: func() cogito.Source {
@@ -87,6 +131,44 @@ func TestSourceValidationSuccess(t *testing.T) {
 	}
 }
 
+func TestSourceValidationDefaultNotifyStates(t *testing.T) {
+	type testCase struct {
+		name        string
+		transitions []cogito.Transition
+		want        []cogito.BuildState
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		source := cogito.Source{
+			Owner:                   "the-owner",
+			Repo:                    "the-repo",
+			AccessToken:             "the-token",
+			ChatNotifyOnTransitions: tc.transitions,
+		}
+
+		err := source.Validate()
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, source.ChatNotifyOnStates, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "states only",
+			want: []cogito.BuildState{cogito.StateAbort, cogito.StateError, cogito.StateFailure},
+		},
+		{
+			name:        "transitions disable the default states",
+			transitions: []cogito.Transition{cogito.TransitionFixed},
+			want:        nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestSourceValidationFailure(t *testing.T) {
 	type testCase struct {
 		name    string
@@ -180,6 +262,298 @@ func TestSourceValidationFailure(t *testing.T) {
 			},
 			wantErr: "source: invalid github_api_hostname: https://github.foo.com/api/v3/. Don't configure the schema or the path",
 		},
+		{
+			name: "repos: missing repo",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				Repos:       []cogito.RepoSource{{Owner: "the-owner"}},
+			},
+			wantErr: "source: repos[0]: missing keys: owner, repo",
+		},
+		{
+			name: "repos: same as owner/repo",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				Repos:       []cogito.RepoSource{{Owner: "The-Owner", Repo: "the-repo"}},
+			},
+			wantErr: "source: repos[0]: duplicate of owner/repo: The-Owner/the-repo",
+		},
+		{
+			name: "repos: duplicate element",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				Repos: []cogito.RepoSource{
+					{Owner: "the-owner", Repo: "the-lib"},
+					{Owner: "the-owner", Repo: "the-lib", Context: "lib"},
+				},
+			},
+			wantErr: "source: repos[1]: duplicate of repos[0]: the-owner/the-lib",
+		},
+		{
+			name: "git_remote: invalid name",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				GitRemote:   "the mirror",
+			},
+			wantErr: `source: git_remote: invalid remote name: "the mirror"`,
+		},
+		{
+			name: "git_url_rewrites: missing to",
+			source: cogito.Source{
+				Owner:          "the-owner",
+				Repo:           "the-repo",
+				AccessToken:    "the-token",
+				GitURLRewrites: []cogito.URLRewrite{{From: "git@git-proxy:"}},
+			},
+			wantErr: "source: git_url_rewrites[0]: missing keys: from, to",
+		},
+		{
+			name: "watch_contexts without watch_branch",
+			source: cogito.Source{
+				Owner:         "the-owner",
+				Repo:          "the-repo",
+				AccessToken:   "the-token",
+				WatchContexts: []string{"lint"},
+			},
+			wantErr: "source: watch_contexts and watch_check_runs require watch_branch",
+		},
+		{
+			name: "watch_branch without sink github",
+			source: cogito.Source{
+				Sinks:        []string{"gchat"},
+				GChatWebHook: "sensitive-gchat-webhook",
+				WatchBranch:  "main",
+			},
+			wantErr: "source: watch_branch requires sink github",
+		},
+		{
+			name: "concourse_url without concourse_token",
+			source: cogito.Source{
+				Owner:        "the-owner",
+				Repo:         "the-repo",
+				AccessToken:  "the-token",
+				ConcourseURL: "https://ci.example.org",
+			},
+			wantErr: "source: concourse_url requires concourse_token",
+		},
+		{
+			name: "concourse_url: not a URL",
+			source: cogito.Source{
+				Owner:          "the-owner",
+				Repo:           "the-repo",
+				AccessToken:    "the-token",
+				ConcourseURL:   "ci.example.org",
+				ConcourseToken: "the-concourse-token",
+			},
+			wantErr: `source: concourse_url: want http(s) URL, have: "ci.example.org"`,
+		},
+		{
+			name: "chat_log_lines without concourse_token",
+			source: cogito.Source{
+				Owner:        "the-owner",
+				Repo:         "the-repo",
+				AccessToken:  "the-token",
+				ChatLogLines: 20,
+			},
+			wantErr: "source: chat_log_lines requires concourse_token",
+		},
+		{
+			name: "chat_log_lines: negative",
+			source: cogito.Source{
+				Owner:          "the-owner",
+				Repo:           "the-repo",
+				AccessToken:    "the-token",
+				ConcourseToken: "the-concourse-token",
+				ChatLogLines:   -1,
+			},
+			wantErr: "source: chat_log_lines: want positive number, have: -1",
+		},
+		{
+			name: "chat_notify_on_transitions without previous state",
+			source: cogito.Source{
+				Sinks:                   []string{"gchat"},
+				GChatWebHook:            "sensitive-gchat-webhook",
+				ChatNotifyOnTransitions: []cogito.Transition{cogito.TransitionFixed},
+			},
+			wantErr: "source: chat_notify_on_transitions requires concourse_token or sink github",
+		},
+		{
+			name: "gchat_format: invalid value",
+			source: cogito.Source{
+				Sinks:        []string{"gchat"},
+				GChatWebHook: "sensitive-gchat-webhook",
+				GChatFormat:  "html",
+			},
+			wantErr: `source: gchat_format: invalid value: "html" (valid: card, text)`,
+		},
+		{
+			name: "chat_thread_mode: invalid value",
+			source: cogito.Source{
+				Sinks:          []string{"gchat"},
+				GChatWebHook:   "sensitive-gchat-webhook",
+				ChatThreadMode: "per_job",
+			},
+			wantErr: `source: chat_thread_mode: invalid value: "per_job" (valid: new_thread_per_build, none, thread)`,
+		},
+		{
+			name: "chat_thread_key requires chat_thread_mode thread",
+			source: cogito.Source{
+				Sinks:          []string{"gchat"},
+				GChatWebHook:   "sensitive-gchat-webhook",
+				ChatThreadMode: "none",
+				ChatThreadKey:  "{{.BuildJobName}}",
+			},
+			wantErr: "source: chat_thread_key requires chat_thread_mode: thread",
+		},
+		{
+			name: "chat_thread_key: invalid template",
+			source: cogito.Source{
+				Sinks:         []string{"gchat"},
+				GChatWebHook:  "sensitive-gchat-webhook",
+				ChatThreadKey: "{{.BuildJobName",
+			},
+			wantErr: "source: template: chat_thread_key:1: unclosed action",
+		},
+		{
+			name: "chat_mentions: invalid user ID",
+			source: cogito.Source{
+				Sinks:        []string{"gchat"},
+				GChatWebHook: "sensitive-gchat-webhook",
+				ChatMentions: map[string]string{"ada@example.com": "ada"},
+			},
+			wantErr: `source: chat_mentions: ada@example.com: want users/<id>, have: "ada"`,
+		},
+		{
+			name: "chat_quiet_hours: invalid end",
+			source: cogito.Source{
+				Sinks:          []string{"gchat"},
+				GChatWebHook:   "sensitive-gchat-webhook",
+				ChatQuietHours: []cogito.QuietHours{{Start: "22:00", End: "7"}},
+			},
+			wantErr: `source: chat_quiet_hours[0]: end: want HH:MM, have: "7"`,
+		},
+		{
+			name: "chat_min_interval: invalid duration",
+			source: cogito.Source{
+				Sinks:           []string{"gchat"},
+				GChatWebHook:    "sensitive-gchat-webhook",
+				ConcourseToken:  "sensitive-concourse-token",
+				ChatMinInterval: "30",
+			},
+			wantErr: `source: chat_min_interval: want positive duration (for example 30m), have: "30"`,
+		},
+		{
+			name: "chat_min_interval requires concourse_token",
+			source: cogito.Source{
+				Sinks:           []string{"gchat"},
+				GChatWebHook:    "sensitive-gchat-webhook",
+				ChatMinInterval: "30m",
+			},
+			wantErr: "source: chat_min_interval requires concourse_token",
+		},
+		{
+			name: "routes and gchat_webhook",
+			source: cogito.Source{
+				Sinks:        []string{"gchat"},
+				GChatWebHook: "sensitive-gchat-webhook",
+				Routes:       []cogito.Route{{WebHook: "sensitive-route-webhook"}},
+			},
+			wantErr: "source: routes and gchat_webhook are mutually exclusive",
+		},
+		{
+			name: "routes and gchat_webhook_file",
+			source: cogito.Source{
+				Sinks:            []string{"gchat"},
+				GChatWebHookFile: "secrets/webhook",
+				Routes:           []cogito.Route{{WebHook: "sensitive-route-webhook"}},
+			},
+			wantErr: "source: routes and gchat_webhook are mutually exclusive",
+		},
+		{
+			name: "access_token and access_token_env",
+			source: cogito.Source{
+				Owner:          "the-owner",
+				Repo:           "the-repo",
+				AccessToken:    "sensitive-token",
+				AccessTokenEnv: "THE_TOKEN",
+			},
+			wantErr: "source: access_token, access_token_file and access_token_env are mutually exclusive",
+		},
+		{
+			name: "gchat_webhook_file and gchat_webhook_env",
+			source: cogito.Source{
+				Sinks:            []string{"gchat"},
+				GChatWebHookFile: "secrets/webhook",
+				GChatWebHookEnv:  "THE_WEBHOOK",
+			},
+			wantErr: "source: gchat_webhook, gchat_webhook_file and gchat_webhook_env are mutually exclusive",
+		},
+		{
+			name: "access_token_file and github_app_private_key_env",
+			source: cogito.Source{
+				Owner:                  "the-owner",
+				Repo:                   "the-repo",
+				AccessTokenFile:        "secrets/token",
+				GitHubAppPrivateKeyEnv: "THE_PRIVATE_KEY",
+			},
+			wantErr: "source: cannot specify both github_app and access_token",
+		},
+		{
+			name: "github_app_private_key_env without the other github_app keys",
+			source: cogito.Source{
+				Owner:                  "the-owner",
+				Repo:                   "the-repo",
+				GitHubAppPrivateKeyEnv: "THE_PRIVATE_KEY",
+			},
+			wantErr: "source: missing keys: github_app.client_id, github_app.installation_id",
+		},
+		{
+			name: "routes without sink gchat",
+			source: cogito.Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "sensitive-token",
+				Sinks:       []string{"github"},
+				Routes:      []cogito.Route{{WebHook: "sensitive-route-webhook"}},
+			},
+			wantErr: "source: routes requires sink gchat",
+		},
+		{
+			name: "routes: missing webhook",
+			source: cogito.Source{
+				Sinks:  []string{"gchat"},
+				Routes: []cogito.Route{{WebHook: "sensitive-route-webhook"}, {}},
+			},
+			wantErr: "source: routes[1]: missing key: webhook",
+		},
+		{
+			name: "routes: invalid glob",
+			source: cogito.Source{
+				Sinks: []string{"gchat"},
+				Routes: []cogito.Route{
+					{Jobs: []string{"build-[a"}, WebHook: "sensitive-route-webhook"},
+				},
+			},
+			wantErr: `source: routes[0]: jobs: invalid glob: "build-[a"`,
+		},
+		{
+			name: "routes: invalid sink",
+			source: cogito.Source{
+				Sinks: []string{"gchat"},
+				Routes: []cogito.Route{
+					{Sink: "slack", WebHook: "sensitive-route-webhook"},
+				},
+			},
+			wantErr: `source: routes[0]: sink: invalid value: "slack" (valid: gchat)`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -261,6 +635,10 @@ func TestSourcePrintLogRedaction(t *testing.T) {
 		ContextPrefix:      "the-prefix",
 		ChatAppendSummary:  true,
 		ChatNotifyOnStates: []cogito.BuildState{cogito.StateSuccess, cogito.StateFailure},
+		ConcourseToken:     "sensitive-concourse-token",
+		Routes: []cogito.Route{
+			{Jobs: []string{"release-*"}, WebHook: "sensitive-route-webhook"},
+		},
 	}
 
 	t.Run("fmt.Print redacts fields", func(t *testing.T) {
@@ -319,6 +697,9 @@ sinks: []`
 		assert.Assert(t, cmp.Contains(have, "access_token=***REDACTED***"))
 		assert.Assert(t, cmp.Contains(have, "gchat_webhook=***REDACTED***"))
 		assert.Assert(t, cmp.Contains(have, "github_app.private_key=***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have, "concourse_token=***REDACTED***"))
+		assert.Assert(t, cmp.Contains(have,
+			`routes="[{jobs: [release-*] sink:  webhook: ***REDACTED***}]"`))
 		assert.Assert(t, !strings.Contains(have, "sensitive"))
 	})
 }
@@ -435,3 +816,20 @@ func TestBuildStateUnmarshalJSONFailure(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
 	}
 }
+
+func TestTransitionUnmarshalJSONSuccess(t *testing.T) {
+	var transition cogito.Transition
+
+	err := transition.UnmarshalJSON([]byte(`"still_failing"`))
+
+	assert.NilError(t, err)
+	assert.Equal(t, transition, cogito.TransitionStillFailing)
+}
+
+func TestTransitionUnmarshalJSONFailure(t *testing.T) {
+	var transition cogito.Transition
+
+	err := transition.UnmarshalJSON([]byte(`"failure"`))
+
+	assert.Error(t, err, "invalid transition: failure")
+}
@@ -0,0 +1,68 @@
+package cogito
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PullRequest is the metadata of a pull request, as written by the Concourse
+// github-pr resource (https://github.com/telia-oss/github-pr-resource) in the
+// directory .git/resource of its checkout, one file per field.
+//
+// The checkout of the github-pr resource has at HEAD the merge commit of the PR into
+// the base branch. Since this merge commit is ephemeral, the commit status must be
+// posted on the head commit of the PR instead.
+type PullRequest struct {
+	Number  string // File "pr".
+	URL     string // File "url".
+	Title   string // File "title".
+	HeadSHA string // File "head_sha".
+}
+
+// readPullRequest returns the metadata of the pull request for the repository with
+// working tree repoPath, or nil if the repository has not been fetched by the
+// github-pr resource.
+func readPullRequest(repoPath string) (*PullRequest, error) {
+	gitDir, _, err := gitDirs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	resourceDir := filepath.Join(gitDir, "resource")
+	if _, err := os.Stat(filepath.Join(resourceDir, "head_sha")); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("pull request: %w", err)
+	}
+
+	var pr PullRequest
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"pr", &pr.Number},
+		{"url", &pr.URL},
+		{"title", &pr.Title},
+		{"head_sha", &pr.HeadSHA},
+	}
+	for _, field := range fields {
+		buf, err := os.ReadFile(filepath.Join(resourceDir, field.name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pull request: %w", err)
+		}
+		*field.value = strings.TrimSpace(string(buf))
+	}
+	if !isGitSHA(pr.HeadSHA) {
+		return nil, fmt.Errorf("pull request: .git/resource/head_sha: invalid SHA: %q",
+			pr.HeadSHA)
+	}
+
+	return &pr, nil
+}
@@ -22,10 +22,26 @@ type Putter interface {
 
 // Sinker represents a sink: an endpoint to send a message.
 type Sinker interface {
+	// Plan returns the requests that Send would perform, without performing them.
+	// An empty list means that, given the configuration, the sink would send nothing.
+	Plan() ([]SinkRequest, error)
 	// Send posts the information extracted by the Putter to a specific sink.
 	Send() error
 }
 
+// SinkRequest describes a request that a [Sinker] sends to its backend.
+type SinkRequest struct {
+	Sink   string
+	Method string
+	URL    string // Secrets are redacted.
+	Body   string
+}
+
+// String renders SinkRequest.
+func (sr SinkRequest) String() string {
+	return fmt.Sprintf("%s: %s %s %s", sr.Sink, sr.Method, sr.URL, sr.Body)
+}
+
 // Put implements the "put" step (the "out" executable).
 //
 // From https://concourse-ci.org/implementing-resource-types.html#resource-out:
@@ -1,13 +1,17 @@
 package cogito_test
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
 
 	"github.com/Pix4D/cogito/cogito"
 	"github.com/Pix4D/cogito/testhelp"
@@ -57,6 +61,10 @@ type MockSinker struct {
 	sendError error
 }
 
+func (ms MockSinker) Plan() ([]cogito.SinkRequest, error) {
+	return nil, nil
+}
+
 func (ms MockSinker) Send() error {
 	return ms.sendError
 }
@@ -210,6 +218,116 @@ func TestPutterLoadConfigurationFailure(t *testing.T) {
 			},
 			wantErr: "put: parsing request: invalid build state: burnt-pizza",
 		},
+		{
+			name: "params: statuses: missing context",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{
+					State:    cogito.StateError,
+					Statuses: []cogito.StatusParams{{Context: "lint"}, {State: cogito.StateSuccess}},
+				},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: "put: params: statuses[1]: missing key: context",
+		},
+		{
+			name: "params: statuses: duplicate context",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{
+					State:    cogito.StateError,
+					Statuses: []cogito.StatusParams{{Context: "lint"}, {Context: "lint"}},
+				},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: "put: params: statuses[1]: duplicate context: lint",
+		},
+		{
+			name: "params: invalid action",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{State: cogito.StatePending, Action: "sleep"},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: `put: params: action: invalid value: "sleep" (valid: wait)`,
+		},
+		{
+			name: "params: action wait: missing wait_contexts",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{State: cogito.StatePending, Action: cogito.ActionWait},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: "put: params: action wait: missing key: wait_contexts",
+		},
+		{
+			name: "params: action wait: invalid wait_timeout",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{
+					State:        cogito.StatePending,
+					Action:       cogito.ActionWait,
+					WaitContexts: []string{"lint"},
+					WaitTimeout:  "30",
+				},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: `put: params: wait_timeout: want positive duration (for example 30m), have: "30"`,
+		},
+		{
+			name: "params: action wait: requires sink github",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{
+					State:        cogito.StatePending,
+					Action:       cogito.ActionWait,
+					WaitContexts: []string{"lint"},
+					Sinks:        []string{"gchat"},
+				},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: "put: params: action wait: requires sink github",
+		},
+		{
+			name: "params: wait_contexts without action wait",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{State: cogito.StateError, WaitContexts: []string{"lint"}},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: "put: params: wait_contexts, wait_timeout and wait_check_runs require action: wait",
+		},
+		{
+			name: "params: both commit and commit_file",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{
+					State:      cogito.StateError,
+					Commit:     "5e4e1b1a8c8e8d3f6a8f8b0f2c3d4e5f6a7b8c9d",
+					CommitFile: "dir/commit.txt",
+				},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: "put: params: commit and commit_file are mutually exclusive",
+		},
+		{
+			name: "params: commit: abbreviated SHA",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{State: cogito.StateError, Commit: "5e4e1b1"},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: `put: params: commit: want full SHA in lowercase hex, have: "5e4e1b1"`,
+		},
+		{
+			name: "params: gchat_format: invalid value",
+			putInput: cogito.PutRequest{
+				Source: baseGithubSource,
+				Params: cogito.PutParams{State: cogito.StateError, GChatFormat: "html"},
+			},
+			args:    []string{"dummy-dir"},
+			wantErr: `put: params: gchat_format: invalid value: "html" (valid: card, text)`,
+		},
 		{
 			name:     "arguments: missing input directory",
 			putInput: basePutRequest,
@@ -223,6 +341,47 @@ func TestPutterLoadConfigurationFailure(t *testing.T) {
 	}
 }
 
+// A text that is not a valid template is sent as-is: it must not fail the put.
+func TestPutterLoadConfigurationNotATemplate(t *testing.T) {
+	type testCase struct {
+		name   string
+		params cogito.PutParams
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		inputDir := t.TempDir()
+		assert.NilError(t, os.Mkdir(filepath.Join(inputDir, "msgdir"), 0o770))
+		assert.NilError(t, os.WriteFile(filepath.Join(inputDir, "msgdir", "msg.txt"),
+			[]byte("line 1\n{{ foo | default(\"x\") }}\n"), 0o660))
+		in := testhelp.ToJSON(t, cogito.PutRequest{Source: baseGithubSource, Params: tc.params})
+		putter := cogito.NewPutter(testhelp.MakeTestLog())
+
+		err := putter.LoadConfiguration(in, []string{inputDir})
+
+		assert.NilError(t, err)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "chat_message",
+			params: cogito.PutParams{State: cogito.StateError, ChatMessage: "{{.State"},
+		},
+		{
+			name:   "chat_message_file",
+			params: cogito.PutParams{State: cogito.StateError, ChatMessageFile: "msgdir/msg.txt"},
+		},
+		{
+			name: "description_file",
+			params: cogito.PutParams{State: cogito.StateError,
+				DescriptionFile: "msgdir/msg.txt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
 func TestPutterLoadConfigurationInvalidParamsFailure(t *testing.T) {
 	in := []byte(`
 {
@@ -251,6 +410,40 @@ func TestPutterLoadConfigurationMissingGchatwebHook(t *testing.T) {
 	assert.Error(t, err, wantErr)
 }
 
+func TestPutterLoadConfigurationSecretEnvSuccess(t *testing.T) {
+	t.Setenv("COGITO_TEST_TOKEN", "the-token-from-env\n")
+	in := []byte(`
+{
+  "source": {
+    "owner": "the-owner",
+    "repo": "the-repo",
+    "access_token_env": "COGITO_TEST_TOKEN"
+  },
+  "params": {"state": "success"}
+}`)
+	putter := cogito.NewPutter(testhelp.MakeTestLog())
+
+	err := putter.LoadConfiguration(in, []string{"dummy-dir"})
+
+	assert.NilError(t, err)
+	assert.Equal(t, putter.Request.Source.AccessToken, "the-token-from-env")
+}
+
+func TestPutterLoadConfigurationSecretEnvFailure(t *testing.T) {
+	t.Setenv("COGITO_TEST_WEBHOOK", "")
+	in := []byte(`
+{
+  "source": {"sinks": ["gchat"], "gchat_webhook_env": "COGITO_TEST_WEBHOOK"},
+  "params": {}
+}`)
+	wantErr := `put: source: gchat_webhook_env: environment variable COGITO_TEST_WEBHOOK is not set or empty`
+	putter := cogito.NewPutter(testhelp.MakeTestLog())
+
+	err := putter.LoadConfiguration(in, nil)
+
+	assert.Error(t, err, wantErr)
+}
+
 func TestPutterLoadConfigurationUnknownSink(t *testing.T) {
 	in := []byte(`
 {
@@ -314,6 +507,15 @@ func TestPutterProcessInputDirSuccess(t *testing.T) {
 			sink:     nil,
 			params:   cogito.PutParams{ChatMessageFile: "msgdir/msg.txt"},
 		},
+		{
+			name:     "two dirs: repo and msg dir shared by chat_message_file and description_file",
+			inputDir: "testdata/repo-and-msgdir",
+			sink:     nil,
+			params: cogito.PutParams{
+				ChatMessageFile: "msgdir/msg.txt",
+				DescriptionFile: "msgdir/msg.txt",
+			},
+		},
 		{
 			name:     "only msg dir, but gchat is set",
 			inputDir: "testdata/repo-and-msgdir/msgdir",
@@ -332,6 +534,30 @@ func TestPutterProcessInputDirSuccess(t *testing.T) {
 	}
 }
 
+func TestPutterProcessInputDirStatusesFileSuccess(t *testing.T) {
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, "testdata/repo-and-msgdir",
+		"https://github.com/dummy-owner/dummy-repo", "dummySHA", "banana")
+	putter := cogito.NewPutter(testhelp.MakeTestLog())
+	putter.InputDir = filepath.Join(tmpDir, "repo-and-msgdir")
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{GhHostname: github.GhDefaultHostname, Owner: "dummy-owner", Repo: "dummy-repo"},
+		Params: cogito.PutParams{
+			StatusesFile: "msgdir/statuses.yml",
+			Statuses:     []cogito.StatusParams{{Context: "build", State: cogito.StateSuccess}},
+		},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.NilError(t, err)
+	assert.Equal(t, putter.Request.Params.State, cogito.StateFailure)
+	assert.DeepEqual(t, putter.Request.Params.Statuses, []cogito.StatusParams{
+		{Context: "build", State: cogito.StateSuccess},
+		{Context: "lint", State: cogito.StateFailure, Description: "12 issues"},
+		{Context: "unit", State: cogito.StateSuccess},
+	})
+}
+
 func TestPutterProcessInputDirFailure(t *testing.T) {
 	type testCase struct {
 		name     string
@@ -380,7 +606,19 @@ func TestPutterProcessInputDirFailure(t *testing.T) {
 		{
 			name:     "git repo, but something wrong",
 			inputDir: "testdata/one-repo",
-			wantErr:  "git commit: branch checkout: read SHA file: open ",
+			wantErr:  "git commit: branch checkout: ref mango: not found (neither loose nor packed)",
+		},
+		{
+			name:     "commit set, repo is still validated",
+			inputDir: "testdata/not-a-repo",
+			params:   cogito.PutParams{Commit: "5e4e1b1a8c8e8d3f6a8f8b0f2c3d4e5f6a7b8c9d"},
+			wantErr:  "parsing .git/config: open ",
+		},
+		{
+			name:     "commit_file does not contain a SHA",
+			inputDir: "testdata/repo-and-msgdir",
+			params:   cogito.PutParams{CommitFile: "msgdir/msg.txt"},
+			wantErr:  "commit_file msgdir/msg.txt: want full SHA in lowercase hex, have: ",
 		},
 		{
 			name:     "repo and msgdir, but missing dir in chat_message_file",
@@ -394,6 +632,21 @@ func TestPutterProcessInputDirFailure(t *testing.T) {
 			params:   cogito.PutParams{ChatMessageFile: "banana/msg.txt"},
 			wantErr:  "put:inputs: directory for chat_message_file not found: have: [a-repo msgdir], chat_message_file: banana/msg.txt",
 		},
+		{
+			name:     "description_file specified but different put:inputs",
+			inputDir: "testdata/repo-and-msgdir",
+			params:   cogito.PutParams{DescriptionFile: "banana/msg.txt"},
+			wantErr:  "put:inputs: directory for description_file not found: have: [a-repo msgdir], description_file: banana/msg.txt",
+		},
+		{
+			name:     "statuses_file with context already in statuses",
+			inputDir: "testdata/repo-and-msgdir",
+			params: cogito.PutParams{
+				StatusesFile: "msgdir/statuses.yml",
+				Statuses:     []cogito.StatusParams{{Context: "unit"}},
+			},
+			wantErr: "statuses and statuses_file: statuses[2]: duplicate context: unit",
+		},
 		{
 			name:     "chat_message_file specified but too few put:inputs",
 			inputDir: "testdata/one-repo",
@@ -442,6 +695,64 @@ func TestPutterCustomSinks(t *testing.T) {
 	assert.Assert(t, ok1)
 }
 
+func TestPutterActionWaitSinks(t *testing.T) {
+	putter := cogito.NewPutter(testhelp.MakeTestLog())
+	putter.Request = cogito.PutRequest{
+		Params: cogito.PutParams{Action: cogito.ActionWait, WaitContexts: []string{"lint"}},
+	}
+	sinks := putter.Sinks()
+	assert.Assert(t, len(sinks) == 1)
+	_, ok := sinks[0].(cogito.GitHubWaitSink)
+	assert.Assert(t, ok)
+}
+
+func TestPutterDryRunSuccess(t *testing.T) {
+	wantSHA := "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	inputDir := testhelp.MakeGitRepoFromTestdata(t, "testdata/one-repo",
+		"https://github.com/the-owner/the-repo", "dummySHA", wantSHA)
+	putter := cogito.NewPutter(testhelp.MakeTestLog())
+	putter.InputDir = filepath.Join(inputDir, "one-repo")
+	putter.Request = cogito.PutRequest{
+		Source: cogito.Source{
+			GhHostname:         github.GhDefaultHostname,
+			Owner:              "the-owner",
+			Repo:               "the-repo",
+			GChatWebHook:       "https://chat.example/v1/spaces/X/messages?key=sensitive-key",
+			ChatNotifyOnStates: []cogito.BuildState{cogito.StateSuccess},
+		},
+		Params: cogito.PutParams{State: cogito.StateSuccess, DryRun: true},
+		Env: cogito.Environment{
+			BuildJobName:      "the-job",
+			BuildName:         "42",
+			BuildPipelineName: "the-pipeline",
+		},
+	}
+	assert.NilError(t, putter.ProcessInputDir())
+
+	// Put would fail if any sink attempted to reach the (non-existent) servers.
+	for _, sink := range putter.Sinks() {
+		assert.NilError(t, sink.Send())
+	}
+	var out bytes.Buffer
+	err := putter.Output(&out)
+
+	assert.NilError(t, err)
+	var have cogito.Output
+	testhelp.FromJSON(t, out.Bytes(), &have)
+	assert.Equal(t, len(have.Metadata), 3)
+	assert.Equal(t, have.Metadata[1].Name, cogito.KeyDryRun)
+	assert.Assert(t, cmp.Contains(have.Metadata[1].Value,
+		"gchat: POST https://chat.example/v1/spaces/X/messages?"+
+			"key=REDACTED&messageReplyOption=REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD"+
+			"&threadKey=the-pipeline+"+wantSHA))
+	assert.Assert(t, !strings.Contains(have.Metadata[1].Value, "sensitive"))
+	assert.Equal(t, have.Metadata[2].Name, cogito.KeyDryRun)
+	assert.Equal(t, have.Metadata[2].Value,
+		"github: POST https://api.github.com/repos/the-owner/the-repo/statuses/"+wantSHA+
+			` {"state":"success","target_url":"/teams/pipelines/the-pipeline/jobs/the-job/builds/42",`+
+			`"description":"Build 42","context":"the-job"}`)
+}
+
 func TestPutterOutputSuccess(t *testing.T) {
 	putter := cogito.NewPutter(testhelp.MakeTestLog())
 
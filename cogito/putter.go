@@ -1,18 +1,25 @@
 package cogito
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/sasbury/mini"
+	"gopkg.in/yaml.v3"
 
+	"github.com/Pix4D/cogito/gitobj"
 	"github.com/Pix4D/go-kit/github"
 	"github.com/Pix4D/go-kit/sets"
 )
@@ -25,12 +32,29 @@ type ProdPutter struct {
 	// Cogito specific fields.
 	log    *slog.Logger
 	gitRef string
+	branch string          // Empty if not available.
+	commit *gitobj.Commit  // Nil if not available.
+	pr     *PullRequest    // Nil if the repo is not from the github-pr resource.
+	build  *ConcourseBuild // Nil if source.concourse_token is not set.
+	change *StateChange    // Nil if the previous state is not known.
+	// Email of a commit author to chat user ID, from source.chat_mentions and
+	// params.chat_mentions_file.
+	mentions map[string]string
+	// The reason not to send to chat, see source.chat_quiet_hours and
+	// source.chat_min_interval. Empty if none.
+	chatSuppressed string
+	chatSent       bool // Set by the gchat sink.
+	// The commits of the repos of source.repos found in the put inputs.
+	extraRepos []RepoCommit
+	planned    []SinkRequest    // Filled only in dry-run mode.
+	now        func() time.Time // Overridden only in tests.
 }
 
 // NewPutter returns a Cogito ProdPutter.
 func NewPutter(log *slog.Logger) *ProdPutter {
 	return &ProdPutter{
 		log: log.With("name", "cogito.put"),
+		now: time.Now,
 	}
 }
 
@@ -50,7 +74,7 @@ func (putter *ProdPutter) LoadConfiguration(input []byte, args []string) error {
 	putParamsSinks := putter.Request.Params.Sinks
 
 	// Validate optional sinks configuration.
-	_, err = MergeAndValidateSinks(sourceSinks, putParamsSinks)
+	sinks, err := MergeAndValidateSinks(sourceSinks, putParamsSinks)
 	if err != nil {
 		return fmt.Errorf("put: arguments: unsupported sink(s): %w", err)
 	}
@@ -61,12 +85,116 @@ func (putter *ProdPutter) LoadConfiguration(input []byte, args []string) error {
 	}
 	putter.InputDir = args[0]
 	putter.log.Debug("", "input-directory", putter.InputDir)
+
+	if err := validateStatuses(putter.Request.Params.Statuses); err != nil {
+		return fmt.Errorf("put: params: %s", err)
+	}
+	if err := validateCommit(putter.Request.Params); err != nil {
+		return fmt.Errorf("put: params: %s", err)
+	}
+	if err := validateAction(putter.Request.Params, sinks); err != nil {
+		return fmt.Errorf("put: params: %s", err)
+	}
+	if err := validateGChatFormat(putter.Request.Params.GChatFormat); err != nil {
+		return fmt.Errorf("put: params: %s", err)
+	}
+	putter.parseTemplates()
 	buildState := putter.Request.Params.State
 	putter.log.Debug("", "state", buildState)
 
 	return nil
 }
 
+// parseTemplates validates the templates in the put params, to report errors as early
+// as possible. Since a text that is not a valid template is sent as-is, the errors are
+// only warnings.
+func (putter *ProdPutter) parseTemplates() {
+	params := putter.Request.Params
+	type keyText struct{ key, text string }
+	texts := []keyText{
+		{"chat_message", params.ChatMessage},
+		{"description", params.Description},
+		{"target_url", params.TargetURL},
+	}
+	for i, status := range params.Statuses {
+		texts = append(texts,
+			keyText{fmt.Sprintf("statuses[%d].description", i), status.Description},
+			keyText{fmt.Sprintf("statuses[%d].target_url", i), status.TargetURL})
+	}
+	for _, elem := range texts {
+		if _, err := parseTemplate(elem.key, elem.text); err != nil {
+			putter.log.Warn("not a template, will be used as-is", "error", err)
+		}
+	}
+	for _, file := range params.inputFiles() {
+		if !file.template {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(putter.InputDir, file.path))
+		// If the file cannot be read, ProcessInputDir will report a more precise error.
+		if err != nil {
+			continue
+		}
+		if _, err := parseTemplate(file.path, string(contents)); err != nil {
+			putter.log.Warn("not a template, will be used as-is", "error", err)
+		}
+	}
+}
+
+// validateCommit verifies put params commit and commit_file.
+func validateCommit(params PutParams) error {
+	if params.Commit != "" && params.CommitFile != "" {
+		return fmt.Errorf("commit and commit_file are mutually exclusive")
+	}
+	if params.Commit != "" && !isGitSHA(params.Commit) {
+		return fmt.Errorf("commit: want full SHA in lowercase hex, have: %q", params.Commit)
+	}
+	return nil
+}
+
+// validateAction verifies put param action and the params that depend on it.
+func validateAction(params PutParams, sinks *sets.Set[string]) error {
+	switch params.Action {
+	case "":
+		if len(params.WaitContexts) > 0 || params.WaitTimeout != "" || params.WaitCheckRuns {
+			return fmt.Errorf("wait_contexts, wait_timeout and wait_check_runs require action: %s",
+				ActionWait)
+		}
+		return nil
+	case ActionWait:
+	default:
+		return fmt.Errorf("action: invalid value: %q (valid: %s)", params.Action, ActionWait)
+	}
+
+	if len(params.WaitContexts) == 0 {
+		return fmt.Errorf("action %s: missing key: wait_contexts", ActionWait)
+	}
+	if params.WaitTimeout != "" {
+		if timeout, err := time.ParseDuration(params.WaitTimeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("wait_timeout: want positive duration (for example 30m), have: %q",
+				params.WaitTimeout)
+		}
+	}
+	if !sinks.Contains("github") {
+		return fmt.Errorf("action %s: requires sink github", ActionWait)
+	}
+	return nil
+}
+
+// validateStatuses verifies the elements of put param statuses.
+func validateStatuses(statuses []StatusParams) error {
+	contexts := sets.New[string](len(statuses))
+	for i, status := range statuses {
+		if status.Context == "" {
+			return fmt.Errorf("statuses[%d]: missing key: context", i)
+		}
+		if contexts.Add(status.Context) {
+			return fmt.Errorf("statuses[%d]: duplicate context: %s", i, status.Context)
+		}
+	}
+	return nil
+}
+
 func (putter *ProdPutter) ProcessInputDir() error {
 	// putter.InputDir, corresponding to key "put:inputs:", may contain 0, 1 or 2 dirs.
 	// If it contains zero, Cogito addresses only a supported chat system (custom sinks configured).
@@ -76,6 +204,8 @@ func (putter *ProdPutter) ProcessInputDir() error {
 	// If on the other hand it contains two, one should be the git repo (still nameless)
 	// and the other should be the directory containing the chat_message_file, which is
 	// named by the first element of the path in "chat_message_file".
+	// The same applies to the other params naming a file, such as "description_file";
+	// they can share the same directory.
 	// This allows (although clumsily) to distinguish which is which.
 	// This complexity has historical reasons to preserve backwards compatibility
 	// (the nameless git repo).
@@ -90,83 +220,436 @@ func (putter *ProdPutter) ProcessInputDir() error {
 	// Get wanted sinks (already validated in LoadConfiguration()).
 	sinks, _ := MergeAndValidateSinks(source.Sinks, params.Sinks)
 
-	var msgDir string
-
 	collected, err := collectInputDirs(putter.InputDir)
 	if err != nil {
 		return err
 	}
 
 	inputDirs := sets.From(collected...)
+	msgDirs := sets.New[string](0)
 
-	if params.ChatMessageFile != "" {
-		msgDir, _ = path.Split(params.ChatMessageFile)
+	for _, file := range slices.Concat(source.inputFiles(), params.inputFiles()) {
+		msgDir, _ := path.Split(file.path)
 		msgDir = strings.TrimSuffix(msgDir, "/")
 		if msgDir == "" {
-			return fmt.Errorf("chat_message_file: wrong format: have: %s, want: path of the form: <dir>/<file>",
-				params.ChatMessageFile)
+			return fmt.Errorf("%s: wrong format: have: %s, want: path of the form: <dir>/<file>",
+				file.key, file.path)
 		}
 
-		found := inputDirs.Remove(msgDir)
-		if !found {
-			return fmt.Errorf("put:inputs: directory for chat_message_file not found: have: %v, chat_message_file: %s",
-				collected, params.ChatMessageFile)
+		if !slices.Contains(collected, msgDir) {
+			return fmt.Errorf("put:inputs: directory for %s not found: have: %v, %s: %s",
+				file.key, collected, file.key, file.path)
 		}
+		inputDirs.Remove(msgDir)
+		msgDirs.Add(msgDir)
 	}
 
-	switch inputDirs.Size() {
-	case 0:
-		// If the size is 0 after removing the directory containing the chat message
-		// and Cogito should update the commit status, return an error.
-		if sinks.Contains("github") {
-			return fmt.Errorf(
-				"put:inputs: missing directory for GitHub repo: have: %v, GitHub: %s/%s",
-				inputDirs, source.Owner, source.Repo)
+	if err := putter.Request.Source.readSecretFiles(os.DirFS(putter.InputDir)); err != nil {
+		return fmt.Errorf("source: %s", err)
+	}
+
+	if params.StatusesFile != "" {
+		if err := putter.mergeStatusesFile(); err != nil {
+			return err
 		}
-		putter.log.Debug("", "inputDirs", inputDirs, "msgDir", msgDir)
-	case 1:
-		repoDir := filepath.Join(putter.InputDir, inputDirs.OrderedList()[0])
-		putter.log.Debug("", "inputDirs", inputDirs, "repoDir", repoDir, "msgDir", msgDir)
-		if err := checkGitRepoDir(repoDir, source.GhHostname, source.Owner, source.Repo); err != nil {
+	}
+
+	putter.mentions = maps.Clone(source.ChatMentions)
+	if params.ChatMentionsFile != "" {
+		mentions, err := readChatMentionsFile(os.DirFS(putter.InputDir),
+			params.ChatMentionsFile)
+		if err != nil {
 			return err
 		}
-		putter.gitRef, err = getGitCommit(repoDir)
+		// The file takes precedence over the source.
+		if putter.mentions == nil {
+			putter.mentions = make(map[string]string, len(mentions))
+		}
+		maps.Copy(putter.mentions, mentions)
+	}
+
+	// If set, put param commit or commit_file bypasses the HEAD of the git repo.
+	commit, err := putter.explicitCommit()
+	if err != nil {
+		return err
+	}
+
+	var repoDir string
+	switch {
+	case inputDirs.Size() == 0:
+	case len(source.Repos) > 0:
+		repoDir, err = putter.matchRepoDirs(inputDirs.OrderedList())
 		if err != nil {
 			return err
 		}
-		putter.log.Debug("", "git-ref", putter.gitRef)
+	case inputDirs.Size() == 1:
+		repoDir = filepath.Join(putter.InputDir, inputDirs.OrderedList()[0])
+		if err := checkGitRepoDir(repoDir, source); err != nil {
+			return err
+		}
 	default:
 		// If the size exceeds 1, too many directories are passed to Cogito.
 		return fmt.Errorf(
 			"put:inputs: want only directory for GitHub repo: have: %v, GitHub: %s/%s",
 			inputDirs, source.Owner, source.Repo)
 	}
+	putter.log.Debug("", "inputDirs", inputDirs, "repoDir", repoDir, "msgDirs", msgDirs)
+
+	if repoDir == "" {
+		// If there is no directory for the GitHub repo after removing the directory
+		// containing the chat message and Cogito should update the commit status
+		// without an explicit commit, return an error.
+		if sinks.Contains("github") && commit == "" {
+			return fmt.Errorf(
+				"put:inputs: missing directory for GitHub repo: have: %v, GitHub: %s/%s",
+				inputDirs, source.Owner, source.Repo)
+		}
+		putter.gitRef = commit
+	} else if err := putter.readRepoDir(repoDir, commit); err != nil {
+		return err
+	}
+
+	putter.fetchConcourseBuild()
+	if sinks.Contains("gchat") {
+		putter.findStateChange()
+		putter.findChatSuppression()
+	}
 
 	return nil
 }
 
+// findChatSuppression finds if the chat message must not be sent, because of
+// source.chat_quiet_hours or source.chat_min_interval. Like the build information, the
+// time of the last chat message is nice to have: if it cannot be read, the message is
+// sent.
+func (putter *ProdPutter) findChatSuppression() {
+	request := putter.Request
+	if request.Params.Action == ActionWait {
+		return
+	}
+	now := putter.now()
+	putter.chatSuppressed = quietHoursReason(request.Source.ChatQuietHours,
+		request.Params.State, now)
+	if putter.chatSuppressed != "" || request.Source.ChatMinInterval == "" {
+		return
+	}
+	if request.Params.DryRun {
+		putter.log.Info("dry run: not reading time of last chat message")
+		return
+	}
+
+	if request.Env.BuildId == "" {
+		putter.log.Warn("cannot read time of last chat message", "reason", "BUILD_ID not set")
+		return
+	}
+	// Already validated.
+	interval, _ := time.ParseDuration(request.Source.ChatMinInterval)
+	client := newConcourseClient(putter.log.With("name", "concourse"), request.Source,
+		request.Env)
+	last, err := client.lastChatTime(request.Env, now.Add(-interval))
+	if err != nil {
+		putter.log.Warn("cannot read time of last chat message", "error", err)
+		return
+	}
+	if !last.IsZero() {
+		putter.chatSuppressed = fmt.Sprintf(
+			"chat_min_interval %s: previous message sent %s ago", interval,
+			now.Sub(last).Round(time.Second))
+	}
+}
+
+// readRepoDir sets the git ref, the commit details and the pull request of the input
+// git repository repoDir. If not empty, commit overrides the HEAD of the repository.
+func (putter *ProdPutter) readRepoDir(repoDir, commit string) error {
+	var err error
+	putter.pr, err = readPullRequest(repoDir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case commit != "":
+		putter.gitRef = commit
+	case putter.pr != nil:
+		// HEAD is the ephemeral merge commit of the PR into the base branch.
+		putter.log.Info("pull request detected: using the head of the PR",
+			"pr", putter.pr.Number, "head-sha", putter.pr.HeadSHA)
+		putter.gitRef = putter.pr.HeadSHA
+	default:
+		putter.gitRef, err = getGitCommit(putter.log, repoDir)
+		if err != nil {
+			return err
+		}
+	}
+	putter.log.Debug("", "git-ref", putter.gitRef)
+	// The commit details are nice to have: do not fail if they cannot be read.
+	details, err := readGitCommit(repoDir, putter.gitRef)
+	if err != nil {
+		putter.log.Warn("cannot read commit details", "git-ref", putter.gitRef,
+			"error", err)
+	} else {
+		putter.commit = &details
+	}
+	// The branch is used only to match source.routes: same as above.
+	putter.branch, err = readGitBranch(repoDir)
+	if err != nil {
+		putter.log.Warn("cannot read branch", "error", err)
+	}
+	putter.log.Debug("", "branch", putter.branch)
+
+	return nil
+}
+
+// fetchConcourseBuild reads the information about the current build from the
+// Concourse API, if source.concourse_token is set. Like the commit details, the build
+// information is nice to have: do not fail if it cannot be read.
+func (putter *ProdPutter) fetchConcourseBuild() {
+	source := putter.Request.Source
+	env := putter.Request.Env
+	if source.ConcourseToken == "" || putter.Request.Params.Action == ActionWait {
+		return
+	}
+	if putter.Request.Params.DryRun {
+		putter.log.Info("dry run: not reading build information")
+		return
+	}
+	if env.BuildId == "" {
+		putter.log.Warn("cannot read build information", "reason", "BUILD_ID not set")
+		return
+	}
+	client := newConcourseClient(putter.log.With("name", "concourse"), source, env)
+	build, err := client.fetchBuild(env.BuildId, putter.now())
+	if err != nil {
+		putter.log.Warn("cannot read build information", "build-id", env.BuildId,
+			"error", err)
+		return
+	}
+	putter.log.Debug("", "build", build)
+	putter.build = &build
+}
+
+// findStateChange finds the state of the previous build, if
+// source.chat_notify_on_transitions is set, to compute the transition. The previous
+// build is read from the Concourse API if source.concourse_token is set, otherwise
+// from the GitHub commit status of the parent commit. Like the commit details, the
+// transition is nice to have: do not fail if it cannot be found.
+func (putter *ProdPutter) findStateChange() {
+	request := putter.Request
+	state := request.Params.State
+	if len(request.Source.ChatNotifyOnTransitions) == 0 ||
+		request.Params.Action == ActionWait || !(isFailing(state) || state == StateSuccess) {
+		return
+	}
+	if request.Params.DryRun {
+		putter.log.Info("dry run: not reading previous state")
+		return
+	}
+
+	var previous BuildState
+	current := state
+	var err error
+	switch {
+	case request.Source.ConcourseToken != "":
+		if request.Env.BuildId == "" {
+			putter.log.Warn("cannot find previous state", "reason", "BUILD_ID not set")
+			return
+		}
+		client := newConcourseClient(putter.log.With("name", "concourse"),
+			request.Source, request.Env)
+		previous, err = client.previousBuildState(request.Env)
+	case putter.commit != nil && len(putter.commit.Parents) > 0:
+		previous, err = ghPreviousState(putter.log.With("name", "ghPrevious"), request,
+			putter.commit.Parents[0])
+		// Compare the same contexts.
+		current = ghPostedState(request)
+	default:
+		putter.log.Warn("cannot find previous state", "reason", "parent commit unknown")
+		return
+	}
+	if err != nil {
+		putter.log.Warn("cannot find previous state", "error", err)
+		return
+	}
+	if previous == "" {
+		putter.log.Info("no previous state: transitions disabled for this build")
+		return
+	}
+	putter.change = &StateChange{
+		Previous:   previous,
+		Transition: stateTransition(previous, current),
+	}
+	putter.log.Debug("", "previous-state", previous,
+		"transition", putter.change.Transition)
+}
+
+// matchRepoDirs matches each of dirs, by the URL of its git remote, either to
+// source.owner/repo or to an element of source.repos. It returns the path of the
+// directory matching source.owner/repo, or the empty string if none. For the other
+// directories, it stores the commit on which to set the status.
+func (putter *ProdPutter) matchRepoDirs(dirs []string) (string, error) {
+	source := putter.Request.Source
+	var primaryDir string
+	matched := make(map[int]string, len(dirs))
+
+	for _, dir := range dirs {
+		repoDir := filepath.Join(putter.InputDir, dir)
+		gitUrl, gu, err := gitRemoteURL(repoDir, source)
+		if err != nil {
+			return "", fmt.Errorf("put:inputs: %s: %w", dir, err)
+		}
+		if !strings.EqualFold(gu.URL.Host, source.GhHostname) {
+			return "", fmt.Errorf("put:inputs: %s: remote %s: want hostname %s",
+				dir, gitUrl, source.GhHostname)
+		}
+
+		if sameRepo(gu.Owner, gu.Repo, source.Owner, source.Repo) {
+			if primaryDir != "" {
+				return "", fmt.Errorf("put:inputs: %s and %s: same repository %s/%s",
+					filepath.Base(primaryDir), dir, source.Owner, source.Repo)
+			}
+			primaryDir = repoDir
+			continue
+		}
+
+		i := slices.IndexFunc(source.Repos, func(repo RepoSource) bool {
+			return sameRepo(gu.Owner, gu.Repo, repo.Owner, repo.Repo)
+		})
+		if i < 0 {
+			return "", fmt.Errorf(
+				"put:inputs: %s: remote %s matches neither %s/%s nor any of source.repos",
+				dir, gitUrl, source.Owner, source.Repo)
+		}
+		repo := source.Repos[i]
+		if other, found := matched[i]; found {
+			return "", fmt.Errorf("put:inputs: %s and %s: same repository %s/%s",
+				other, dir, repo.Owner, repo.Repo)
+		}
+		matched[i] = dir
+
+		gitRef, err := getGitCommit(putter.log, repoDir)
+		if err != nil {
+			return "", fmt.Errorf("put:inputs: %s: %w", dir, err)
+		}
+		putter.log.Debug("", "repoDir", repoDir, "repo", repo.Owner+"/"+repo.Repo,
+			"git-ref", gitRef)
+		putter.extraRepos = append(putter.extraRepos, RepoCommit{
+			Owner:   repo.Owner,
+			Repo:    repo.Repo,
+			Context: repo.Context,
+			GitRef:  gitRef,
+		})
+	}
+
+	return primaryDir, nil
+}
+
+// sameRepo reports whether owner1/repo1 and owner2/repo2 are the same GitHub
+// repository. GitHub names are case-insensitive.
+func sameRepo(owner1, repo1, owner2, repo2 string) bool {
+	return strings.EqualFold(owner1, owner2) && strings.EqualFold(repo1, repo2)
+}
+
+// explicitCommit returns the commit SHA from put param commit or commit_file, or the
+// empty string if neither is set.
+func (putter *ProdPutter) explicitCommit() (string, error) {
+	params := putter.Request.Params
+	if params.CommitFile == "" {
+		// Already validated in LoadConfiguration.
+		return params.Commit, nil
+	}
+	buf, err := os.ReadFile(filepath.Join(putter.InputDir, params.CommitFile))
+	if err != nil {
+		return "", fmt.Errorf("reading commit_file: %s", err)
+	}
+	commit := strings.TrimSpace(string(buf))
+	if !isGitSHA(commit) {
+		return "", fmt.Errorf("commit_file %s: want full SHA in lowercase hex, have: %q",
+			params.CommitFile, commit)
+	}
+	putter.log.Debug("", "commit_file", params.CommitFile, "commit", commit)
+	return commit, nil
+}
+
+// mergeStatusesFile reads put param statuses_file and appends its statuses to put
+// param statuses. If put param state is not set, it is set to the most severe state
+// found in the file.
+func (putter *ProdPutter) mergeStatusesFile() error {
+	params := &putter.Request.Params
+	statuses, err := readStatusesFile(os.DirFS(putter.InputDir), params.StatusesFile)
+	if err != nil {
+		return err
+	}
+	for i := range statuses {
+		if statuses[i].Context == "" {
+			statuses[i].Context = params.Context
+		}
+	}
+	if len(params.Statuses) > 0 {
+		if err := validateStatuses(append(slices.Clone(params.Statuses), statuses...)); err != nil {
+			return fmt.Errorf("statuses and statuses_file: %s", err)
+		}
+	}
+	params.Statuses = append(params.Statuses, statuses...)
+	if params.State == "" {
+		params.State = worstState(statuses)
+	}
+	putter.log.Debug("", "statuses_file", params.StatusesFile, "statuses", params.Statuses,
+		"state", params.State)
+	return nil
+}
+
 func (putter *ProdPutter) Sinks() []Sinker {
 	supportedSinkers := map[string]Sinker{
 		"github": GitHubCommitStatusSink{
-			Log:     putter.log.With("name", "ghCommitStatus"),
-			GitRef:  putter.gitRef,
-			Request: putter.Request,
+			Log:        putter.log.With("name", "ghCommitStatus"),
+			InputDir:   os.DirFS(putter.InputDir),
+			GitRef:     putter.gitRef,
+			Commit:     putter.commit,
+			Build:      putter.build,
+			ExtraRepos: putter.extraRepos,
+			Request:    putter.Request,
 		},
 		"gchat": GoogleChatSink{
 			Log: putter.log.With("name", "gChat"),
 			// TODO putter.InputDir itself should be of type fs.FS.
-			InputDir: os.DirFS(putter.InputDir),
-			GitRef:   putter.gitRef,
-			Request:  putter.Request,
+			InputDir:    os.DirFS(putter.InputDir),
+			GitRef:      putter.gitRef,
+			Branch:      putter.branch,
+			Commit:      putter.commit,
+			PullRequest: putter.pr,
+			Build:       putter.build,
+			StateChange: putter.change,
+			Mentions:    putter.mentions,
+			Suppressed:  putter.chatSuppressed,
+			Sent:        &putter.chatSent,
+			Request:     putter.Request,
 		},
 	}
 	source := putter.Request.Source.Sinks
 	params := putter.Request.Params.Sinks
 	sinks, _ := MergeAndValidateSinks(source, params)
+	if putter.Request.Params.Action == ActionWait {
+		// Waiting is a gate: it neither sets the commit status nor sends to chat.
+		supportedSinkers = map[string]Sinker{
+			"github": GitHubWaitSink{
+				Log:     putter.log.With("name", "ghWait"),
+				GitRef:  putter.gitRef,
+				Request: putter.Request,
+			},
+		}
+		sinks = sets.From("github")
+	}
 
 	sinkers := make([]Sinker, 0, sinks.Size())
 	for _, s := range sinks.OrderedList() {
-		sinkers = append(sinkers, supportedSinkers[s])
+		sinker := supportedSinkers[s]
+		if putter.Request.Params.DryRun {
+			sinker = dryRunSink{
+				Sinker:  sinker,
+				log:     putter.log.With("name", "dryRun"),
+				planned: &putter.planned,
+			}
+		}
+		sinkers = append(sinkers, sinker)
 	}
 
 	return sinkers
@@ -176,9 +659,13 @@ func (putter *ProdPutter) Output(out io.Writer) error {
 	// Following the protocol for put, we return the version and metadata.
 	// For Cogito, the metadata contains the Concourse build state.
 	output := Output{
-		Version:  DummyVersion,
+		Version:  putter.version(),
 		Metadata: []Metadata{{Name: KeyState, Value: string(putter.Request.Params.State)}},
 	}
+	// In dry-run mode, the metadata contains also what would have been sent.
+	for _, req := range putter.planned {
+		output.Metadata = append(output.Metadata, Metadata{Name: KeyDryRun, Value: req.String()})
+	}
 	enc := json.NewEncoder(out)
 	if err := enc.Encode(output); err != nil {
 		return fmt.Errorf("put: %s", err)
@@ -190,6 +677,79 @@ func (putter *ProdPutter) Output(out io.Writer) error {
 	return nil
 }
 
+// version returns the version emitted by put: the commit, the GitHub contexts and the
+// state that have been posted, and the current time, to tell apart two puts of the
+// same state on the same commit.
+func (putter *ProdPutter) version() Version {
+	request := putter.Request
+	params := request.Params
+	// Nothing has been posted.
+	if params.DryRun {
+		return DummyVersion
+	}
+	ref := putter.gitRef
+	if ref == "" {
+		ref = DummyVersion.Ref
+	}
+	state := string(params.State)
+
+	var contexts, repos []string
+	sinks, _ := MergeAndValidateSinks(request.Source.Sinks, params.Sinks)
+	switch {
+	case params.Action == ActionWait:
+		// The put step succeeded, so all the contexts succeeded.
+		contexts = params.WaitContexts
+		state = string(StateSuccess)
+	case sinks.Contains("github"):
+		for _, req := range ghStatusRequests(request) {
+			contexts = append(contexts, ghMakeContext(req))
+		}
+		// As done by GitHubCommitStatusSink.
+		for _, extra := range putter.extraRepos {
+			req := request
+			if extra.Context != "" {
+				req.Params.Context = extra.Context
+			}
+			repos = append(repos, fmt.Sprintf("%s/%s@%s:%s",
+				extra.Owner, extra.Repo, extra.GitRef, ghMakeContext(req)))
+		}
+	}
+
+	version := Version{
+		Ref:     ref,
+		Context: strings.Join(contexts, ","),
+		State:   state,
+		Time:    putter.now().UTC().Format(time.RFC3339),
+		Repos:   strings.Join(repos, ","),
+	}
+	if putter.chatSent {
+		version.ChatTime = version.Time
+	}
+	return version
+}
+
+// dryRunSink wraps a [Sinker]: instead of sending, it logs the requests that the wrapped
+// Sinker would send and records them, so that they can be emitted as metadata.
+type dryRunSink struct {
+	Sinker
+	log     *slog.Logger
+	planned *[]SinkRequest
+}
+
+// Send logs and records the requests that the wrapped Sinker would send.
+func (sink dryRunSink) Send() error {
+	requests, err := sink.Plan()
+	if err != nil {
+		return err
+	}
+	for _, req := range requests {
+		sink.log.Info("not sending", "reason", "dry_run", "sink", req.Sink,
+			"method", req.Method, "url", req.URL, "body", req.Body)
+	}
+	*sink.planned = append(*sink.planned, requests...)
+	return nil
+}
+
 // MergeAndValidateSinks returns an error if the user set an unsupported sink in source or put.params.
 // If validation passes, it return the list of sinks to address:
 // - return sinks in put.params if found.
@@ -212,6 +772,127 @@ func MergeAndValidateSinks(sourceSinks []string, paramsSinks []string) (*sets.Se
 	return sinks, nil
 }
 
+// inputFile is a put param naming a file in the put inputs, with format <dir>/<file>.
+type inputFile struct {
+	key      string // The name of the put param.
+	path     string
+	template bool // The contents are a template.
+}
+
+// inputFiles returns the put params naming a file in the put inputs, if set.
+func (params PutParams) inputFiles() []inputFile {
+	var files []inputFile
+	if params.ChatMessageFile != "" {
+		files = append(files, inputFile{"chat_message_file", params.ChatMessageFile, true})
+	}
+	if params.DescriptionFile != "" {
+		files = append(files, inputFile{"description_file", params.DescriptionFile, true})
+	}
+	if params.StatusesFile != "" {
+		files = append(files, inputFile{"statuses_file", params.StatusesFile, false})
+	}
+	if params.CommitFile != "" {
+		files = append(files, inputFile{"commit_file", params.CommitFile, false})
+	}
+	if params.ChatMentionsFile != "" {
+		files = append(files,
+			inputFile{"chat_mentions_file", params.ChatMentionsFile, false})
+	}
+	return files
+}
+
+// readStatusesFile parses the contents of put param statuses_file, which can be JSON or
+// YAML and contain either a single status or a list of statuses. A single status
+// can omit the context, which then defaults as for the top-level put params.
+func readStatusesFile(inputDir fs.FS, name string) ([]StatusParams, error) {
+	contents, err := fs.ReadFile(inputDir, name)
+	if err != nil {
+		return nil, fmt.Errorf("reading statuses_file: %s", err)
+	}
+
+	// JSON is a subset of YAML, so we parse as YAML. We then convert to JSON to reuse
+	// the JSON decoder, which validates the fields and the build states.
+	var generic any
+	if err := yaml.Unmarshal(contents, &generic); err != nil {
+		return nil, fmt.Errorf("parsing statuses_file %s: %s", name, err)
+	}
+	buf, err := json.Marshal(generic)
+	if err != nil {
+		return nil, fmt.Errorf("parsing statuses_file %s: %s", name, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	var statuses []StatusParams
+	if _, isList := generic.([]any); isList {
+		err = dec.Decode(&statuses)
+	} else {
+		var status StatusParams
+		err = dec.Decode(&status)
+		statuses = append(statuses, status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing statuses_file %s: %s", name, err)
+	}
+	if len(statuses) == 0 {
+		return nil, fmt.Errorf("parsing statuses_file %s: no statuses", name)
+	}
+	if len(statuses) > 1 {
+		if err := validateStatuses(statuses); err != nil {
+			return nil, fmt.Errorf("statuses_file %s: %s", name, err)
+		}
+	}
+	for i, status := range statuses {
+		if status.State == "" {
+			return nil, fmt.Errorf("statuses_file %s: statuses[%d]: missing key: state",
+				name, i)
+		}
+	}
+
+	return statuses, nil
+}
+
+// readChatMentionsFile parses the contents of put param chat_mentions_file, a JSON or
+// YAML map from the email of a commit author to a chat user ID, as source key
+// chat_mentions.
+func readChatMentionsFile(inputDir fs.FS, name string) (map[string]string, error) {
+	contents, err := fs.ReadFile(inputDir, name)
+	if err != nil {
+		return nil, fmt.Errorf("reading chat_mentions_file: %s", err)
+	}
+	var mentions map[string]string
+	if err := yaml.Unmarshal(contents, &mentions); err != nil {
+		return nil, fmt.Errorf("parsing chat_mentions_file %s: %s", name, err)
+	}
+	if err := validateChatMentions(mentions); err != nil {
+		return nil, fmt.Errorf("chat_mentions_file %s: %s", name, err)
+	}
+	return mentions, nil
+}
+
+// validateChatMentions verifies a map from email to chat user ID, as source key
+// chat_mentions.
+func validateChatMentions(mentions map[string]string) error {
+	for _, email := range slices.Sorted(maps.Keys(mentions)) {
+		user := mentions[email]
+		id, found := strings.CutPrefix(user, "users/")
+		if !found || id == "" || strings.ContainsAny(id, "<> ") {
+			return fmt.Errorf("%s: want users/<id>, have: %q", email, user)
+		}
+	}
+	return nil
+}
+
+// worstState returns the most severe state among statuses.
+func worstState(statuses []StatusParams) BuildState {
+	severity := []BuildState{StateSuccess, StatePending, StateAbort, StateFailure, StateError}
+	worst := 0
+	for _, status := range statuses {
+		worst = max(worst, slices.Index(severity, status.State))
+	}
+	return severity[worst]
+}
+
 // collectInputDirs returns a list of all directories below dir (non-recursive).
 func collectInputDirs(dir string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
@@ -230,32 +911,16 @@ func collectInputDirs(dir string) ([]string, error) {
 // checkGitRepoDir validates whether DIR, assumed to be received as input of a put step,
 // contains a git repository usable with the Cogito source configuration:
 // - DIR is indeed a git repository.
-// - The repo configuration contains a "remote origin" section.
-// - The remote origin url can be parsed following the GitHub conventions.
-// - The result of the parse matches OWNER and REPO.
-func checkGitRepoDir(dir, hostname, owner, repo string) error {
-	cfg, err := mini.LoadConfiguration(filepath.Join(dir, ".git/config"))
-	if err != nil {
-		return fmt.Errorf("parsing .git/config: %w", err)
-	}
-
-	// .git/config contains a section like:
-	//
-	// [remote "origin"]
-	//     url = git@github.com:Pix4D/cogito.git
-	//     fetch = +refs/heads/*:refs/remotes/origin/*
-	//
-	const section = `remote "origin"`
-	const key = "url"
-	gitUrl := cfg.StringFromSection(section, key, "")
-	if gitUrl == "" {
-		return fmt.Errorf(".git/config: key [%s]/%s: not found", section, key)
-	}
-	gu, err := github.ParseGitPseudoURL(gitUrl)
+// - The repo configuration contains a section for remote source.GitRemote.
+// - The remote url, after source.GitURLRewrites, can be parsed following the GitHub
+// conventions.
+// - The result of the parse matches source.GhHostname, source.Owner and source.Repo.
+func checkGitRepoDir(dir string, source Source) error {
+	gitUrl, gu, err := gitRemoteURL(dir, source)
 	if err != nil {
-		return fmt.Errorf(".git/config: remote: %w", err)
+		return err
 	}
-	left := []string{hostname, owner, repo}
+	left := []string{source.GhHostname, source.Owner, source.Repo}
 	right := []string{gu.URL.Host, gu.Owner, gu.Repo}
 	for i, l := range left {
 		r := right[i]
@@ -272,15 +937,80 @@ Cogito SOURCE configuration:
     owner: %s
     repo: %s`,
 				gitUrl, gu.Owner, gu.Repo,
-				hostname, owner, repo)
+				source.GhHostname, source.Owner, source.Repo)
 		}
 	}
 	return nil
 }
 
+// gitRemoteURL returns the URL of remote source.GitRemote of the git repository DIR,
+// both raw and parsed following the GitHub conventions. The parsed URL is the one
+// after applying source.GitURLRewrites.
+func gitRemoteURL(dir string, source Source) (string, github.GitURL, error) {
+	_, commonDir, err := gitDirs(dir)
+	if err != nil {
+		return "", github.GitURL{}, err
+	}
+	cfg, err := mini.LoadConfiguration(filepath.Join(commonDir, "config"))
+	if err != nil {
+		return "", github.GitURL{}, fmt.Errorf("parsing .git/config: %w", err)
+	}
+
+	// .git/config contains a section like:
+	//
+	// [remote "origin"]
+	//     url = git@github.com:Pix4D/cogito.git
+	//     fetch = +refs/heads/*:refs/remotes/origin/*
+	//
+	remote := source.GitRemote
+	if remote == "" {
+		remote = "origin"
+	}
+	section := fmt.Sprintf("remote %q", remote)
+	const key = "url"
+	gitUrl := cfg.StringFromSection(section, key, "")
+	if gitUrl == "" {
+		return "", github.GitURL{}, fmt.Errorf(".git/config: key [%s]/%s: not found",
+			section, key)
+	}
+	rewritten := rewriteURL(gitUrl, source.GitURLRewrites)
+	gu, err := github.ParseGitPseudoURL(rewritten)
+	if err != nil {
+		return "", github.GitURL{}, fmt.Errorf(".git/config: remote: %w", err)
+	}
+	if rewritten != gitUrl {
+		gitUrl = fmt.Sprintf("%s (rewritten: %s)", gitUrl, rewritten)
+	}
+	return gitUrl, gu, nil
+}
+
+// rewriteURL returns gitUrl rewritten by the rule of rewrites with the longest From
+// that is a prefix of gitUrl, as git does for url.<base>.insteadOf. If no rule
+// matches, it returns gitUrl unchanged.
+func rewriteURL(gitUrl string, rewrites []URLRewrite) string {
+	var best URLRewrite
+	for _, rw := range rewrites {
+		if strings.HasPrefix(gitUrl, rw.From) && len(rw.From) > len(best.From) {
+			best = rw
+		}
+	}
+	if best.From == "" {
+		return gitUrl
+	}
+	return best.To + strings.TrimPrefix(gitUrl, best.From)
+}
+
 // getGitCommit looks into a git repository and extracts the commit SHA of the HEAD.
-func getGitCommit(repoPath string) (string, error) {
-	dotGitPath := filepath.Join(repoPath, ".git")
+// See also [gitDirs] for the supported repository layouts.
+//
+// If the repository has been fetched by the Concourse git resource, file .git/ref
+// records the SHA of the fetched version. HEAD takes precedence, since a task can add
+// commits on top of the fetched version: getGitCommit only warns if they differ.
+func getGitCommit(log *slog.Logger, repoPath string) (string, error) {
+	dotGitPath, commonDir, err := gitDirs(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("git commit: %w", err)
+	}
 
 	headPath := filepath.Join(dotGitPath, "HEAD")
 	headBuf, err := os.ReadFile(headPath)
@@ -303,18 +1033,24 @@ func getGitCommit(repoPath string) (string, error) {
 		// detached head
 		sha = head
 	case 2:
-		// branch checkout
-		shaRelPath := tokens[1]
-		shaPath := filepath.Join(dotGitPath, shaRelPath)
-		shaBuf, err := os.ReadFile(shaPath)
+		// branch checkout. The ref can be a loose file or, for example after a
+		// `git gc`, only in the packed-refs file.
+		sha, err = resolveRef(dotGitPath, commonDir, tokens[1])
 		if err != nil {
-			return "", fmt.Errorf("git commit: branch checkout: read SHA file: %w", err)
+			return "", fmt.Errorf("git commit: branch checkout: %w", err)
 		}
-		sha = strings.TrimSuffix(string(shaBuf), "\n")
 	default:
 		return "", fmt.Errorf("git commit: invalid HEAD format: %q", head)
 	}
 
+	resourceRef, err := readResourceRef(dotGitPath)
+	if err != nil {
+		log.Warn("git commit: ignoring .git/ref", "error", err)
+	} else if resourceRef != "" && resourceRef != sha {
+		log.Warn("git commit: HEAD differs from the version fetched by the git resource, using HEAD",
+			"head", sha, "git-resource-ref", resourceRef)
+	}
+
 	return sha, nil
 }
 
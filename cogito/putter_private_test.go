@@ -3,12 +3,19 @@ package cogito
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"gotest.tools/v3/assert"
 
+	"github.com/Pix4D/cogito/gitobj"
 	"github.com/Pix4D/cogito/testhelp"
 )
 
@@ -61,7 +68,10 @@ func TestCheckGitRepoDirSuccess(t *testing.T) {
 	type testCase struct {
 		name    string
 		dir     string // repoURL to put in file <dir>/.git/config
+		repo    string // path of the repo below dir, if not dir itself
 		repoURL string
+		remote  string
+		rewrite []URLRewrite
 	}
 
 	const wantHostname = "github.com"
@@ -72,8 +82,13 @@ func TestCheckGitRepoDirSuccess(t *testing.T) {
 		inputDir := testhelp.MakeGitRepoFromTestdata(t, tc.dir, tc.repoURL,
 			"dummySHA", "dummyHead")
 
-		err := checkGitRepoDir(filepath.Join(inputDir, filepath.Base(tc.dir)),
-			wantHostname, wantOwner, wantRepo)
+		source := Source{
+			GhHostname: wantHostname, Owner: wantOwner, Repo: wantRepo,
+			GitRemote: tc.remote, GitURLRewrites: tc.rewrite,
+		}
+
+		err := checkGitRepoDir(filepath.Join(inputDir, filepath.Base(tc.dir), tc.repo),
+			source)
 
 		assert.NilError(t, err)
 	}
@@ -99,6 +114,42 @@ func TestCheckGitRepoDirSuccess(t *testing.T) {
 			dir:     "testdata/one-repo/a-repo",
 			repoURL: fmt.Sprintf("https://x-oauth-basic:ghp_XXX@%s/%s/%s.git", wantHostname, wantOwner, wantRepo),
 		},
+		{
+			name:    "linked worktree: config in the common git dir",
+			dir:     "testdata/git-worktree",
+			repo:    "wt",
+			repoURL: testhelp.SshRemote(wantHostname, wantOwner, wantRepo),
+		},
+		{
+			name:    "submodule: config in the git dir of the module",
+			dir:     "testdata/git-submodule",
+			repo:    "super/sub",
+			repoURL: testhelp.SshRemote(wantHostname, wantOwner, wantRepo),
+		},
+		{
+			name:    "remote other than origin",
+			dir:     "testdata/mirror-repo/a-repo",
+			repoURL: testhelp.SshRemote(wantHostname, wantOwner, wantRepo),
+			remote:  "mirror",
+		},
+		{
+			name:    "remote URL of a git proxy, rewritten",
+			dir:     "testdata/mirror-repo/a-repo",
+			repoURL: "https://git-proxy.example.org/github/smiling/butterfly.git",
+			remote:  "mirror",
+			rewrite: []URLRewrite{
+				{From: "https://git-proxy.example.org/", To: "https://gitlab.example.org/"},
+				{From: "https://git-proxy.example.org/github/", To: "https://github.com/"},
+			},
+		},
+		{
+			name:    "remote URL with no matching rewrite",
+			dir:     "testdata/one-repo/a-repo",
+			repoURL: testhelp.SshRemote(wantHostname, wantOwner, wantRepo),
+			rewrite: []URLRewrite{
+				{From: "git@git-proxy.example.org:", To: "git@github.com:"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -111,6 +162,8 @@ func TestCheckGitRepoDirFailure(t *testing.T) {
 		name        string
 		dir         string
 		repoURL     string // repoURL to put in file <dir>/.git/config
+		remote      string
+		rewrite     []URLRewrite
 		wantErrWild string // wildcard matching
 	}
 
@@ -122,8 +175,12 @@ func TestCheckGitRepoDirFailure(t *testing.T) {
 		inDir := testhelp.MakeGitRepoFromTestdata(t, tc.dir, tc.repoURL,
 			"dummySHA", "dummyHead")
 
-		err := checkGitRepoDir(filepath.Join(inDir, filepath.Base(tc.dir)),
-			wantHostname, wantOwner, wantRepo)
+		source := Source{
+			GhHostname: wantHostname, Owner: wantOwner, Repo: wantRepo,
+			GitRemote: tc.remote, GitURLRewrites: tc.rewrite,
+		}
+
+		err := checkGitRepoDir(filepath.Join(inDir, filepath.Base(tc.dir)), source)
 
 		assert.ErrorContains(t, err, tc.wantErrWild)
 	}
@@ -179,6 +236,26 @@ Cogito SOURCE configuration:
 			repoURL:     "foo://bar",
 			wantErrWild: `.git/config: remote: invalid git URL foo://bar: invalid scheme: foo`,
 		},
+		{
+			name:        "remote origin, but the repo has only a different remote",
+			dir:         "testdata/mirror-repo/a-repo",
+			repoURL:     testhelp.SshRemote("github.com", "smiling", "butterfly"),
+			wantErrWild: `.git/config: key [remote "origin"]/url: not found`,
+		},
+		{
+			name:    "rewritten URL of an unrelated repo",
+			dir:     "testdata/mirror-repo/a-repo",
+			repoURL: "git@git-proxy.example.org:owner-a/repo-a.git",
+			remote:  "mirror",
+			rewrite: []URLRewrite{{From: "git@git-proxy.example.org:", To: "git@github.com:"}},
+			wantErrWild: `the received git repository is incompatible with the Cogito configuration.
+
+Git repository configuration (received as 'inputs:' in this PUT step):
+    url: git@git-proxy.example.org:owner-a/repo-a.git (rewritten: git@github.com:owner-a/repo-a.git)
+    owner: owner-a
+    repo: repo-a
+`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -190,8 +267,10 @@ func TestGitGetCommitSuccess(t *testing.T) {
 	type testCase struct {
 		name    string
 		dir     string
+		repo    string // path of the repo below dir, if not dir itself
 		repoURL string
 		head    string
+		want    string // if empty, wantSHA
 	}
 
 	const wantSHA = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
@@ -199,11 +278,16 @@ func TestGitGetCommitSuccess(t *testing.T) {
 
 	test := func(t *testing.T, tc testCase) {
 		tmpDir := testhelp.MakeGitRepoFromTestdata(t, tc.dir, tc.repoURL, wantSHA, tc.head)
+		want := tc.want
+		if want == "" {
+			want = wantSHA
+		}
 
-		sha, err := getGitCommit(filepath.Join(tmpDir, filepath.Base(tc.dir)))
+		sha, err := getGitCommit(testhelp.MakeTestLog(),
+			filepath.Join(tmpDir, filepath.Base(tc.dir), tc.repo))
 
 		assert.NilError(t, err)
-		assert.Equal(t, sha, wantSHA)
+		assert.Equal(t, sha, want)
 	}
 
 	testCases := []testCase{
@@ -219,6 +303,46 @@ func TestGitGetCommitSuccess(t *testing.T) {
 			repoURL: "dummy",
 			head:    wantSHA,
 		},
+		{
+			name:    "branch ref only in packed-refs",
+			dir:     "testdata/git-packed-refs",
+			repoURL: "dummy",
+			head:    defHead,
+		},
+		{
+			name:    "git resource .git/ref with tag, same as detached HEAD",
+			dir:     "testdata/git-resource-ref",
+			repoURL: "dummy",
+			head:    wantSHA,
+		},
+		{
+			name:    "commits added on top of the git resource .git/ref: HEAD wins",
+			dir:     "testdata/git-resource-ref",
+			repoURL: "dummy",
+			head:    "5e4e1b1a8c8e8d3f6a8f8b0f2c3d4e5f6a7b8c9d",
+			want:    "5e4e1b1a8c8e8d3f6a8f8b0f2c3d4e5f6a7b8c9d",
+		},
+		{
+			name:    "linked worktree, branch checkout",
+			dir:     "testdata/git-worktree",
+			repo:    "wt",
+			repoURL: "dummy",
+			head:    defHead,
+		},
+		{
+			name:    "linked worktree, detached HEAD",
+			dir:     "testdata/git-worktree",
+			repo:    "wt",
+			repoURL: "dummy",
+			head:    wantSHA,
+		},
+		{
+			name:    "submodule, branch ref in packed-refs",
+			dir:     "testdata/git-submodule",
+			repo:    "super/sub",
+			repoURL: "dummy",
+			head:    defHead,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -240,7 +364,8 @@ func TestGitGetCommitFailure(t *testing.T) {
 	test := func(t *testing.T, tc testCase) {
 		tmpDir := testhelp.MakeGitRepoFromTestdata(t, tc.dir, tc.repoURL, wantSHA, tc.head)
 
-		_, err := getGitCommit(filepath.Join(tmpDir, filepath.Base(tc.dir)))
+		_, err := getGitCommit(testhelp.MakeTestLog(),
+			filepath.Join(tmpDir, filepath.Base(tc.dir)))
 
 		assert.ErrorContains(t, err, tc.wantErr)
 	}
@@ -265,7 +390,306 @@ func TestGitGetCommitFailure(t *testing.T) {
 			dir:     "testdata/one-repo/a-repo",
 			repoURL: "dummyURL",
 			head:    "banana mango",
-			wantErr: "git commit: branch checkout: read SHA file: open ",
+			wantErr: "git commit: branch checkout: ref mango: not found (neither loose nor packed)",
+		},
+		{
+			name:    "branch not in packed-refs",
+			dir:     "testdata/git-packed-refs",
+			repoURL: "dummyURL",
+			head:    "ref: refs/heads/banana",
+			wantErr: "git commit: branch checkout: ref refs/heads/banana: not found (neither loose nor packed)",
+		},
+		{
+			name:    ".git file without gitdir",
+			dir:     "testdata/git-bad-gitfile",
+			repoURL: "dummyURL",
+			head:    "dummy",
+			wantErr: `git commit: git dir: invalid .git file format: "banana"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestProcessInputDirExplicitCommit(t *testing.T) {
+	type testCase struct {
+		name     string
+		inputDir string
+		params   PutParams
+		sinks    []string
+	}
+
+	// The SHA in testdata/*/msgdir/commit.txt.
+	const wantSHA = "5e4e1b1a8c8e8d3f6a8f8b0f2c3d4e5f6a7b8c9d"
+
+	test := func(t *testing.T, tc testCase) {
+		// HEAD is broken: the explicit commit must bypass it.
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, tc.inputDir,
+			"https://github.com/the-owner/the-repo", "dummySHA", "banana mango")
+		putter := NewPutter(testhelp.MakeTestLog())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(tc.inputDir))
+		putter.Request = PutRequest{
+			Source: Source{GhHostname: "github.com", Owner: "the-owner", Repo: "the-repo",
+				Sinks: tc.sinks},
+			Params: tc.params,
+		}
+
+		err := putter.ProcessInputDir()
+
+		assert.NilError(t, err)
+		assert.Equal(t, putter.gitRef, wantSHA)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "commit, with repo",
+			inputDir: "testdata/one-repo",
+			params:   PutParams{Commit: wantSHA},
+		},
+		{
+			name:     "commit_file, with repo",
+			inputDir: "testdata/repo-and-msgdir",
+			params:   PutParams{CommitFile: "msgdir/commit.txt"},
+		},
+		{
+			name:     "commit_file, without repo",
+			inputDir: "testdata/only-msgdir",
+			params:   PutParams{CommitFile: "msgdir/commit.txt"},
+			sinks:    []string{"github", "gchat"},
+		},
+		{
+			name:     "commit overrides the pull request head",
+			inputDir: "testdata/github-pr",
+			params:   PutParams{Commit: wantSHA},
+		},
+		{
+			name:     "commit, without any input",
+			inputDir: "testdata/empty-dir",
+			params:   PutParams{Commit: wantSHA},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestProcessInputDirChatMentions(t *testing.T) {
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, "testdata/only-msgdir",
+		"https://github.com/the-owner/the-repo", "dummySHA", "banana")
+	putter := NewPutter(testhelp.MakeTestLog())
+	putter.InputDir = filepath.Join(tmpDir, "only-msgdir")
+	putter.Request = PutRequest{
+		Source: Source{
+			Sinks: []string{"gchat"},
+			ChatMentions: map[string]string{
+				"ada@example.com":  "users/0",
+				"alan@example.com": "users/333",
+			},
+		},
+		Params: PutParams{ChatMentionsFile: "msgdir/mentions.yml"},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.NilError(t, err)
+	want := map[string]string{
+		"ada@example.com":   "users/111",
+		"grace@example.com": "users/222",
+		"alan@example.com":  "users/333",
+	}
+	assert.Assert(t, maps.Equal(putter.mentions, want),
+		"have: %v\nwant: %v", putter.mentions, want)
+}
+
+func TestProcessInputDirSecretFiles(t *testing.T) {
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, "testdata/only-msgdir",
+		"https://github.com/the-owner/the-repo", "dummySHA", "banana")
+	putter := NewPutter(testhelp.MakeTestLog())
+	putter.InputDir = filepath.Join(tmpDir, "only-msgdir")
+	putter.Request = PutRequest{
+		Source: Source{
+			Sinks:            []string{"gchat"},
+			GChatWebHookFile: "msgdir/webhook.txt",
+		},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.NilError(t, err)
+	assert.Equal(t, putter.Request.Source.GChatWebHook,
+		"https://chat.example/v1/spaces/the-space/messages?key=the-key")
+	assert.Equal(t, putter.Sinks()[0].(GoogleChatSink).Request.Source.GChatWebHook,
+		"https://chat.example/v1/spaces/the-space/messages?key=the-key")
+}
+
+func TestFindChatSuppression(t *testing.T) {
+	type testCase struct {
+		name   string
+		source Source
+		now    time.Time
+		want   string
+	}
+
+	ts := fakeATC(t, nil, true)
+
+	test := func(t *testing.T, tc testCase) {
+		putter := NewPutter(testhelp.MakeTestLog())
+		putter.Request = PutRequest{
+			Source: tc.source,
+			Params: PutParams{State: StateFailure},
+			Env: Environment{
+				BuildId:           "1234",
+				BuildTeamName:     "main",
+				BuildPipelineName: "the-pipeline",
+				BuildJobName:      "the-job",
+				AtcExternalUrl:    ts.URL,
+			},
+		}
+		putter.now = func() time.Time { return tc.now }
+
+		putter.findChatSuppression()
+
+		assert.Equal(t, putter.chatSuppressed, tc.want)
+	}
+
+	// The last chat message of the fake ATC is at 09:49 UTC.
+	testCases := []testCase{
+		{
+			name: "quiet hours",
+			source: Source{ChatQuietHours: []QuietHours{
+				{Start: "09:00", End: "10:00", AllowStates: []BuildState{StateError}},
+			}},
+			now:  time.Date(2026, 1, 1, 9, 55, 0, 0, time.UTC),
+			want: "chat_quiet_hours 09:00-10:00 UTC",
+		},
+		{
+			name:   "within min interval",
+			source: Source{ConcourseToken: "the-concourse-token", ChatMinInterval: "30m"},
+			now:    time.Date(2026, 1, 1, 9, 55, 0, 0, time.UTC),
+			want:   "chat_min_interval 30m0s: previous message sent 6m0s ago",
+		},
+		{
+			name:   "after min interval",
+			source: Source{ConcourseToken: "the-concourse-token", ChatMinInterval: "30m"},
+			now:    time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC),
+			want:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+// The dry-run mode must not perform any network call, neither to Concourse nor to GitHub.
+func TestPutterLookupsDryRun(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	t.Cleanup(ts.Close)
+	hostname, _ := strings.CutPrefix(ts.URL, "http://")
+
+	for _, token := range []string{"the-concourse-token", ""} {
+		putter := NewPutter(testhelp.MakeTestLog())
+		putter.commit = &gitobj.Commit{Parents: []string{"the-parent-sha"}}
+		putter.Request = PutRequest{
+			Source: Source{
+				Owner:                   "the-owner",
+				Repo:                    "the-repo",
+				AccessToken:             "the-token",
+				GhHostname:              hostname,
+				ConcourseToken:          token,
+				ConcourseURL:            ts.URL,
+				ChatMinInterval:         "30m",
+				ChatNotifyOnTransitions: []Transition{TransitionBroken},
+			},
+			Params: PutParams{State: StateFailure, DryRun: true},
+			Env:    Environment{BuildId: "1234", AtcExternalUrl: ts.URL},
+		}
+
+		putter.fetchConcourseBuild()
+		putter.findStateChange()
+		putter.findChatSuppression()
+
+		assert.Equal(t, calls, 0, "concourse_token: %q", token)
+		assert.Assert(t, putter.build == nil)
+		assert.Assert(t, putter.change == nil)
+		assert.Equal(t, putter.chatSuppressed, "")
+	}
+}
+
+func TestProcessInputDirPullRequest(t *testing.T) {
+	// Written by the github-pr resource in .git/resource/head_sha.
+	const wantSHA = "0123456789abcdef0123456789abcdef01234567"
+	tmpDir := testhelp.MakeGitRepoFromTestdata(t, "testdata/github-pr",
+		"https://github.com/the-owner/the-repo", "dummySHA", "ref: refs/heads/a-branch-FIXME")
+	putter := NewPutter(testhelp.MakeTestLog())
+	putter.InputDir = filepath.Join(tmpDir, "github-pr")
+	putter.Request = PutRequest{
+		Source: Source{GhHostname: "github.com", Owner: "the-owner", Repo: "the-repo"},
+	}
+
+	err := putter.ProcessInputDir()
+
+	assert.NilError(t, err)
+	assert.Equal(t, putter.gitRef, wantSHA)
+	assert.DeepEqual(t, putter.pr, &PullRequest{
+		Number:  "42",
+		URL:     "https://github.com/the-owner/the-repo/pull/42",
+		Title:   "Add the banana feature",
+		HeadSHA: wantSHA,
+	})
+}
+
+func TestReadPullRequest(t *testing.T) {
+	type testCase struct {
+		name    string
+		files   map[string]string // Files in .git/resource.
+		want    *PullRequest
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		repoDir := t.TempDir()
+		resourceDir := filepath.Join(repoDir, ".git", "resource")
+		assert.NilError(t, os.MkdirAll(resourceDir, 0o770))
+		for name, contents := range tc.files {
+			err := os.WriteFile(filepath.Join(resourceDir, name), []byte(contents), 0o660)
+			assert.NilError(t, err)
+		}
+
+		have, err := readPullRequest(repoDir)
+
+		if tc.wantErr != "" {
+			assert.Error(t, err, tc.wantErr)
+			return
+		}
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:  "not a github-pr checkout",
+			files: map[string]string{"ref": "the git resource has no head_sha"},
+			want:  nil,
+		},
+		{
+			name: "only head_sha",
+			files: map[string]string{
+				"head_sha": "0123456789abcdef0123456789abcdef01234567\n",
+			},
+			want: &PullRequest{HeadSHA: "0123456789abcdef0123456789abcdef01234567"},
+		},
+		{
+			name:    "invalid head_sha",
+			files:   map[string]string{"head_sha": "banana"},
+			wantErr: `pull request: .git/resource/head_sha: invalid SHA: "banana"`,
 		},
 	}
 
@@ -274,6 +698,160 @@ func TestGitGetCommitFailure(t *testing.T) {
 	}
 }
 
+func TestProcessInputDirMultipleReposSuccess(t *testing.T) {
+	type testCase struct {
+		name       string
+		inputDir   string
+		wantGitRef string
+		wantExtra  []RepoCommit
+	}
+
+	const commitSHA = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	// The detached HEAD in testdata/two-repos/lib.
+	const libSHA = "1111111111111111111111111111111111111111"
+
+	test := func(t *testing.T, tc testCase) {
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, tc.inputDir,
+			"https://github.com/the-owner/the-repo", commitSHA,
+			"ref: refs/heads/a-branch-FIXME")
+		putter := NewPutter(testhelp.MakeTestLog())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(tc.inputDir))
+		putter.Request = PutRequest{
+			Source: Source{
+				GhHostname: "github.com", Owner: "the-owner", Repo: "the-repo",
+				Repos: []RepoSource{
+					{Owner: "The-Owner", Repo: "The-Lib", Context: "lib"},
+					{Owner: "the-owner", Repo: "the-tool"},
+				},
+			},
+		}
+
+		err := putter.ProcessInputDir()
+
+		assert.NilError(t, err)
+		assert.Equal(t, putter.gitRef, tc.wantGitRef)
+		assert.DeepEqual(t, putter.extraRepos, tc.wantExtra)
+	}
+
+	testCases := []testCase{
+		{
+			name:       "repo and an element of source.repos",
+			inputDir:   "testdata/two-repos",
+			wantGitRef: commitSHA,
+			wantExtra: []RepoCommit{
+				{Owner: "The-Owner", Repo: "The-Lib", Context: "lib", GitRef: libSHA},
+			},
+		},
+		{
+			name:       "only the repo: the elements of source.repos are optional",
+			inputDir:   "testdata/one-repo",
+			wantGitRef: commitSHA,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestProcessInputDirMultipleReposFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		inputDir string
+		repos    []RepoSource
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		tmpDir := testhelp.MakeGitRepoFromTestdata(t, tc.inputDir,
+			"https://github.com/the-owner/the-repo", "dummySHA",
+			"ref: refs/heads/a-branch-FIXME")
+		putter := NewPutter(testhelp.MakeTestLog())
+		putter.InputDir = filepath.Join(tmpDir, filepath.Base(tc.inputDir))
+		putter.Request = PutRequest{
+			Source: Source{
+				GhHostname: "github.com", Owner: "the-owner", Repo: "the-repo",
+				Repos: tc.repos,
+			},
+		}
+
+		err := putter.ProcessInputDir()
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "without source.repos, only one repo is allowed",
+			inputDir: "testdata/two-repos",
+			wantErr:  "put:inputs: want only directory for GitHub repo: have: [lib service], GitHub: the-owner/the-repo",
+		},
+		{
+			name:     "repo not in source.repos",
+			inputDir: "testdata/two-repos",
+			repos:    []RepoSource{{Owner: "the-owner", Repo: "the-tool"}},
+			wantErr:  "put:inputs: lib: remote git@github.com:the-owner/the-lib.git matches neither the-owner/the-repo nor any of source.repos",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadGitBranch(t *testing.T) {
+	type testCase struct {
+		name string
+		head string
+		want string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		repoDir := t.TempDir()
+		assert.NilError(t, os.Mkdir(filepath.Join(repoDir, ".git"), 0o770))
+		assert.NilError(t, os.WriteFile(filepath.Join(repoDir, ".git", "HEAD"),
+			[]byte(tc.head), 0o660))
+
+		have, err := readGitBranch(repoDir)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "branch checkout",
+			head: "ref: refs/heads/release/1.2\n",
+			want: "release/1.2",
+		},
+		{
+			name: "detached head",
+			head: "af6cd86e98eb1485f04d38b78d9532e916bbff02\n",
+			want: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadGitCommit(t *testing.T) {
+	// The objects are generated by gitobj/testdata/make-fixtures.sh.
+	const sha = "adba0ed0cf1f5d2b326081e50bd490322295a6ea"
+	repoDir := t.TempDir()
+	err := os.CopyFS(filepath.Join(repoDir, ".git", "objects"),
+		os.DirFS("../gitobj/testdata/ofs-delta/objects"))
+	assert.NilError(t, err)
+
+	commit, err := readGitCommit(repoDir, sha)
+
+	assert.NilError(t, err)
+	assert.Equal(t, commit.Subject, "Spell out 200")
+	assert.Equal(t, commit.Author.Name, "Ada Lovelace")
+	assert.DeepEqual(t, commit.Parents, []string{"03da27bce541a76847e3ba9796b6fb9dfb43cac5"})
+}
+
 func TestMultiErrString(t *testing.T) {
 	type testCase struct {
 		name    string
@@ -371,3 +949,282 @@ func TestConcourseBuildURL(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
 	}
 }
+
+func TestReadStatusesFileSuccess(t *testing.T) {
+	type testCase struct {
+		name     string
+		contents string
+		want     []StatusParams
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		inputDir := fstest.MapFS{"out/statuses": {Data: []byte(tc.contents)}}
+
+		have, err := readStatusesFile(inputDir, "out/statuses")
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "JSON single status",
+			contents: `{"state":"failure","context":"lint","description":"12 issues"}`,
+			want:     []StatusParams{{State: StateFailure, Context: "lint", Description: "12 issues"}},
+		},
+		{
+			name:     "JSON single status without context",
+			contents: `{"state":"success"}`,
+			want:     []StatusParams{{State: StateSuccess}},
+		},
+		{
+			name: "YAML list",
+			contents: `
+- {context: lint, state: failure, target_url: "https://example.com/lint"}
+- context: unit
+  state: success
+`,
+			want: []StatusParams{
+				{Context: "lint", State: StateFailure, TargetURL: "https://example.com/lint"},
+				{Context: "unit", State: StateSuccess},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadStatusesFileFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		contents string
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		inputDir := fstest.MapFS{"out/statuses": {Data: []byte(tc.contents)}}
+
+		_, err := readStatusesFile(inputDir, "out/statuses")
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "malformed",
+			contents: `{"state": `,
+			wantErr:  "parsing statuses_file out/statuses: yaml: line 1: did not find expected node content",
+		},
+		{
+			name:     "invalid state",
+			contents: `{"state": "pizza"}`,
+			wantErr:  "parsing statuses_file out/statuses: invalid build state: pizza",
+		},
+		{
+			name:     "unknown key",
+			contents: `{"state": "success", "color": "green"}`,
+			wantErr:  `parsing statuses_file out/statuses: json: unknown field "color"`,
+		},
+		{
+			name:     "missing state",
+			contents: `{"context": "lint"}`,
+			wantErr:  "statuses_file out/statuses: statuses[0]: missing key: state",
+		},
+		{
+			name:     "empty list",
+			contents: `[]`,
+			wantErr:  "parsing statuses_file out/statuses: no statuses",
+		},
+		{
+			name:     "list with missing context",
+			contents: `[{"state": "success", "context": "lint"}, {"state": "success"}]`,
+			wantErr:  "statuses_file out/statuses: statuses[1]: missing key: context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadChatMentionsFileSuccess(t *testing.T) {
+	inputDir := fstest.MapFS{"out/mentions": {
+		Data: []byte(`{"ada@example.com": "users/111"}`),
+	}}
+
+	have, err := readChatMentionsFile(inputDir, "out/mentions")
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, have, map[string]string{"ada@example.com": "users/111"})
+}
+
+func TestReadChatMentionsFileFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		contents string
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		inputDir := fstest.MapFS{"out/mentions": {Data: []byte(tc.contents)}}
+
+		_, err := readChatMentionsFile(inputDir, "out/mentions")
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "not a map",
+			contents: `[ada@example.com]`,
+			wantErr:  "parsing chat_mentions_file out/mentions: yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into map[string]string",
+		},
+		{
+			name:     "mention syntax instead of user ID",
+			contents: `ada@example.com: "<users/111>"`,
+			wantErr:  `chat_mentions_file out/mentions: ada@example.com: want users/<id>, have: "<users/111>"`,
+		},
+		{
+			name:     "missing ID",
+			contents: `ada@example.com: users/`,
+			wantErr:  `chat_mentions_file out/mentions: ada@example.com: want users/<id>, have: "users/"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestWorstState(t *testing.T) {
+	type testCase struct {
+		states []BuildState
+		want   BuildState
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		var statuses []StatusParams
+		for _, state := range tc.states {
+			statuses = append(statuses, StatusParams{State: state})
+		}
+
+		assert.Equal(t, worstState(statuses), tc.want)
+	}
+
+	testCases := []testCase{
+		{states: []BuildState{StateSuccess}, want: StateSuccess},
+		{states: []BuildState{StateSuccess, StatePending}, want: StatePending},
+		{states: []BuildState{StateFailure, StateSuccess, StateAbort}, want: StateFailure},
+		{states: []BuildState{StateFailure, StateError}, want: StateError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.states), func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPutterVersion(t *testing.T) {
+	type testCase struct {
+		name     string
+		gitRef   string
+		request  PutRequest
+		chatSent bool
+		extra    []RepoCommit
+		want     Version
+	}
+
+	const sha = "af6cd86e98eb1485f04d38b78d9532e916bbff02"
+	const wantTime = "2026-03-04T09:30:00Z"
+
+	test := func(t *testing.T, tc testCase) {
+		putter := NewPutter(testhelp.MakeTestLog())
+		putter.gitRef = tc.gitRef
+		putter.Request = tc.request
+		putter.chatSent = tc.chatSent
+		putter.extraRepos = tc.extra
+		putter.now = func() time.Time {
+			return time.Date(2026, 3, 4, 10, 30, 0, 0, time.FixedZone("CET", 3600))
+		}
+
+		assert.DeepEqual(t, putter.version(), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:   "one commit status",
+			gitRef: sha,
+			request: PutRequest{
+				Source: Source{ContextPrefix: "ci"},
+				Params: PutParams{State: StateSuccess},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			want: Version{Ref: sha, Context: "ci/the-job", State: "success", Time: wantTime},
+		},
+		{
+			name:   "multiple commit statuses",
+			gitRef: sha,
+			request: PutRequest{
+				Params: PutParams{
+					State:    StateFailure,
+					Statuses: []StatusParams{{Context: "lint"}, {Context: "unit"}},
+				},
+			},
+			want: Version{Ref: sha, Context: "lint,unit", State: "failure", Time: wantTime},
+		},
+		{
+			name: "chat only, without git repo",
+			request: PutRequest{
+				Source: Source{Sinks: []string{"gchat"}},
+				Params: PutParams{State: StateAbort},
+			},
+			want: Version{Ref: "dummy", State: "abort", Time: wantTime},
+		},
+		{
+			name: "chat message sent",
+			request: PutRequest{
+				Source: Source{Sinks: []string{"gchat"}},
+				Params: PutParams{State: StateFailure},
+			},
+			chatSent: true,
+			want: Version{Ref: "dummy", State: "failure", Time: wantTime,
+				ChatTime: wantTime},
+		},
+		{
+			name:   "source.repos",
+			gitRef: sha,
+			request: PutRequest{
+				Params: PutParams{State: StateSuccess},
+				Env:    Environment{BuildJobName: "the-job"},
+			},
+			extra: []RepoCommit{
+				{Owner: "the-owner", Repo: "the-lib", GitRef: "deadbeef"},
+				{Owner: "the-owner", Repo: "the-docs", GitRef: "cafefade",
+					Context: "docs"},
+			},
+			want: Version{Ref: sha, Context: "the-job", State: "success", Time: wantTime,
+				Repos: "the-owner/the-lib@deadbeef:the-job,the-owner/the-docs@cafefade:docs"},
+		},
+		{
+			name:   "dry run",
+			gitRef: sha,
+			request: PutRequest{
+				Params: PutParams{State: StateSuccess, DryRun: true},
+			},
+			want: DummyVersion,
+		},
+		{
+			name:   "action wait",
+			gitRef: sha,
+			request: PutRequest{
+				Params: PutParams{Action: ActionWait, WaitContexts: []string{"lint", "e2e"}},
+			},
+			want: Version{Ref: sha, Context: "lint,e2e", State: "success", Time: wantTime},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,126 @@
+package cogito
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// String renders Route, redacting the webhook.
+func (rt Route) String() string {
+	var bld strings.Builder
+	fmt.Fprint(&bld, "{")
+	if len(rt.States) > 0 {
+		fmt.Fprint(&bld, "states: ", rt.States, " ")
+	}
+	if len(rt.Jobs) > 0 {
+		fmt.Fprint(&bld, "jobs: ", rt.Jobs, " ")
+	}
+	if len(rt.Pipelines) > 0 {
+		fmt.Fprint(&bld, "pipelines: ", rt.Pipelines, " ")
+	}
+	if len(rt.InstanceVars) > 0 {
+		fmt.Fprint(&bld, "instance_vars: ", rt.InstanceVars, " ")
+	}
+	if len(rt.Branches) > 0 {
+		fmt.Fprint(&bld, "branches: ", rt.Branches, " ")
+	}
+	fmt.Fprint(&bld, "sink: ", rt.Sink, " webhook: ", redact(rt.WebHook), "}")
+	return bld.String()
+}
+
+// validate verifies the keys of rt.
+func (rt Route) validate() error {
+	if rt.WebHook == "" {
+		return fmt.Errorf("missing key: webhook")
+	}
+	if rt.Sink != "" && rt.Sink != "gchat" {
+		return fmt.Errorf("sink: invalid value: %q (valid: gchat)", rt.Sink)
+	}
+	globs := []struct {
+		key      string
+		patterns []string
+	}{
+		{"jobs", rt.Jobs},
+		{"pipelines", rt.Pipelines},
+		{"branches", rt.Branches},
+	}
+	for _, elem := range globs {
+		for _, pattern := range elem.patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: invalid glob: %q", elem.key, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// notifyOnStates returns the states that rt sends to chat.
+func (rt Route) notifyOnStates(src Source) []BuildState {
+	if len(rt.States) > 0 {
+		return rt.States
+	}
+	return src.ChatNotifyOnStates
+}
+
+// matches returns true if the build of env, on branch, matches all the keys of rt
+// except the states. Branch can be empty if unknown: then rt matches only if it has no
+// branches.
+func (rt Route) matches(env Environment, branch string) bool {
+	if !matchAnyGlob(rt.Jobs, env.BuildJobName) ||
+		!matchAnyGlob(rt.Pipelines, env.BuildPipelineName) ||
+		!matchAnyGlob(rt.Branches, branch) {
+		return false
+	}
+	if len(rt.InstanceVars) == 0 {
+		return true
+	}
+	// The instance vars are a JSON object, such as {"branch":"stable","version":2}.
+	var vars map[string]any
+	if err := json.Unmarshal([]byte(env.BuildPipelineInstanceVars), &vars); err != nil {
+		return false
+	}
+	for key, want := range rt.InstanceVars {
+		have, found := vars[key]
+		if !found || fmt.Sprint(have) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAnyGlob returns true if patterns is empty or if name matches one of them.
+// The patterns have already been validated.
+func matchAnyGlob(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched && name != ""
+	})
+}
+
+// matchRoute returns the index of the first route of request.Source.Routes that
+// matches the build and that sends its state or transition (change can be nil) to chat,
+// or -1 if none matches. A custom message is sent regardless of chat_notify_on_states,
+// but not regardless of the states of a route.
+func matchRoute(request PutRequest, branch string, change *StateChange) int {
+	for i, route := range request.Source.Routes {
+		if !route.matches(request.Env, branch) {
+			continue
+		}
+		routed := request
+		routed.Source.ChatNotifyOnStates = route.notifyOnStates(request.Source)
+		if len(route.States) > 0 {
+			routed.Params.ChatMessage = ""
+			routed.Params.ChatMessageFile = ""
+		}
+		if shouldSendToChat(routed, change) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,160 @@
+package cogito
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRouteMatches(t *testing.T) {
+	type testCase struct {
+		name   string
+		route  Route
+		branch string
+		want   bool
+	}
+
+	env := Environment{
+		BuildPipelineName:         "the-pipeline",
+		BuildPipelineInstanceVars: `{"branch":"stable","version":2}`,
+		BuildJobName:              "release-linux",
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.NilError(t, tc.route.validate())
+		assert.Equal(t, tc.route.matches(env, tc.branch), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name:  "empty route matches everything",
+			route: Route{WebHook: "w"},
+			want:  true,
+		},
+		{
+			name:  "job glob",
+			route: Route{Jobs: []string{"build-*", "release-*"}, WebHook: "w"},
+			want:  true,
+		},
+		{
+			name:  "job glob, no match",
+			route: Route{Jobs: []string{"build-*"}, WebHook: "w"},
+			want:  false,
+		},
+		{
+			name:  "pipeline",
+			route: Route{Pipelines: []string{"another-pipeline"}, WebHook: "w"},
+			want:  false,
+		},
+		{
+			name: "instance vars, also not strings",
+			route: Route{
+				InstanceVars: map[string]string{"branch": "stable", "version": "2"},
+				WebHook:      "w",
+			},
+			want: true,
+		},
+		{
+			name:  "instance vars, missing",
+			route: Route{InstanceVars: map[string]string{"os": "linux"}, WebHook: "w"},
+			want:  false,
+		},
+		{
+			name:   "branch",
+			route:  Route{Branches: []string{"main", "release/*"}, WebHook: "w"},
+			branch: "release/1.2",
+			want:   true,
+		},
+		{
+			name:  "branch unknown",
+			route: Route{Branches: []string{"*"}, WebHook: "w"},
+			want:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	type testCase struct {
+		name    string
+		state   BuildState
+		job     string
+		change  *StateChange
+		message string
+		want    int
+	}
+
+	// The routes of the example of the README.
+	routes := []Route{
+		{
+			States:   []BuildState{StateFailure, StateError},
+			Branches: []string{"main"},
+			WebHook:  "team-space",
+		},
+		{
+			States:  []BuildState{StateSuccess, StateFailure},
+			Jobs:    []string{"release-*"},
+			WebHook: "releases-space",
+		},
+		{
+			Jobs:    []string{"nightly"},
+			WebHook: "nightly-space",
+		},
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{
+			Source: Source{
+				Routes:                  routes,
+				ChatNotifyOnStates:      defaultNotifyStates,
+				ChatNotifyOnTransitions: []Transition{TransitionFixed},
+			},
+			Params: PutParams{State: tc.state, ChatMessage: tc.message},
+			Env:    Environment{BuildJobName: tc.job},
+		}
+
+		assert.Equal(t, matchRoute(request, "main", tc.change), tc.want)
+	}
+
+	testCases := []testCase{
+		{name: "first match wins", state: StateFailure, job: "release-linux", want: 0},
+		{name: "state of the route", state: StateSuccess, job: "release-linux", want: 1},
+		{name: "default states", state: StateAbort, job: "nightly", want: 2},
+		{name: "no match", state: StateSuccess, job: "unit", want: -1},
+		{
+			name:   "transition",
+			state:  StateSuccess,
+			job:    "unit",
+			change: &StateChange{Previous: StateFailure, Transition: TransitionFixed},
+			want:   0,
+		},
+		{
+			name:    "custom message, states of the route",
+			state:   StateSuccess,
+			job:     "unit",
+			message: "hello",
+			want:    -1,
+		},
+		{
+			name:    "custom message, state of the route",
+			state:   StateSuccess,
+			job:     "release-linux",
+			message: "hello",
+			want:    1,
+		},
+		{
+			name:    "custom message, route without states",
+			state:   StateAbort,
+			job:     "nightly",
+			message: "hello",
+			want:    2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,92 @@
+package cogito
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// secretKey is a sensitive source key that, instead of inline, can be read from a file
+// in the put inputs (<name>_file) or from an environment variable (<name>_env).
+type secretKey struct {
+	key   string  // The inline key.
+	name  string  // The prefix of the file and env keys.
+	value *string // The inline value, filled by the file or env variants.
+	file  string
+	env   string
+}
+
+func (src *Source) secretKeys() []secretKey {
+	return []secretKey{
+		{"access_token", "access_token", &src.AccessToken,
+			src.AccessTokenFile, src.AccessTokenEnv},
+		{"gchat_webhook", "gchat_webhook", &src.GChatWebHook,
+			src.GChatWebHookFile, src.GChatWebHookEnv},
+		{"github_app.private_key", "github_app_private_key", &src.GitHubApp.PrivateKey,
+			src.GitHubAppPrivateKeyFile, src.GitHubAppPrivateKeyEnv},
+	}
+}
+
+// validateSecretKeys verifies that each secret is set in at most one variant.
+func (src *Source) validateSecretKeys() error {
+	for _, sk := range src.secretKeys() {
+		count := 0
+		for _, val := range []string{*sk.value, sk.file, sk.env} {
+			if val != "" {
+				count++
+			}
+		}
+		if count > 1 {
+			return fmt.Errorf("%s, %s_file and %s_env are mutually exclusive",
+				sk.key, sk.name, sk.name)
+		}
+	}
+	return nil
+}
+
+// readSecretEnvs reads the secrets whose key <name>_env is set from the environment.
+func (src *Source) readSecretEnvs() error {
+	for _, sk := range src.secretKeys() {
+		if sk.env == "" {
+			continue
+		}
+		val := strings.TrimSpace(os.Getenv(sk.env))
+		if val == "" {
+			return fmt.Errorf("%s_env: environment variable %s is not set or empty",
+				sk.name, sk.env)
+		}
+		*sk.value = val
+	}
+	return nil
+}
+
+// readSecretFiles reads the secrets whose key <name>_file is set from inputDir.
+func (src *Source) readSecretFiles(inputDir fs.FS) error {
+	for _, sk := range src.secretKeys() {
+		if sk.file == "" {
+			continue
+		}
+		contents, err := fs.ReadFile(inputDir, sk.file)
+		if err != nil {
+			return fmt.Errorf("reading %s_file: %s", sk.name, err)
+		}
+		val := strings.TrimSpace(string(contents))
+		if val == "" {
+			return fmt.Errorf("%s_file %s: empty file", sk.name, sk.file)
+		}
+		*sk.value = val
+	}
+	return nil
+}
+
+// inputFiles returns the source keys naming a file in the put inputs, if set.
+func (src Source) inputFiles() []inputFile {
+	var files []inputFile
+	for _, sk := range src.secretKeys() {
+		if sk.file != "" {
+			files = append(files, inputFile{sk.name + "_file", sk.file, false})
+		}
+	}
+	return files
+}
@@ -0,0 +1,69 @@
+package cogito
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadSecretFilesSuccess(t *testing.T) {
+	inputDir := fstest.MapFS{
+		"secrets/token":           {Data: []byte("the-token\n")},
+		"secrets/private-key.pem": {Data: []byte("the-private-key\n")},
+	}
+	source := Source{
+		AccessTokenFile:         "secrets/token",
+		GitHubAppPrivateKeyFile: "secrets/private-key.pem",
+	}
+
+	err := source.readSecretFiles(inputDir)
+
+	assert.NilError(t, err)
+	assert.Equal(t, source.AccessToken, "the-token")
+	assert.Equal(t, source.GitHubApp.PrivateKey, "the-private-key")
+	assert.Equal(t, source.GChatWebHook, "")
+}
+
+func TestReadSecretFilesFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		source  Source
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		inputDir := fstest.MapFS{"secrets/empty": {Data: []byte(" \n")}}
+
+		err := tc.source.readSecretFiles(inputDir)
+
+		assert.ErrorContains(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing file",
+			source:  Source{AccessTokenFile: "secrets/token"},
+			wantErr: "reading access_token_file: open secrets/token: file does not exist",
+		},
+		{
+			name:    "empty file",
+			source:  Source{GChatWebHookFile: "secrets/empty"},
+			wantErr: "gchat_webhook_file secrets/empty: empty file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadSecretEnvs(t *testing.T) {
+	t.Setenv("COGITO_TEST_PRIVATE_KEY", "the-private-key")
+	source := Source{GitHubAppPrivateKeyEnv: "COGITO_TEST_PRIVATE_KEY"}
+
+	err := source.readSecretEnvs()
+
+	assert.NilError(t, err)
+	assert.Equal(t, source.GitHubApp.PrivateKey, "the-private-key")
+}
@@ -0,0 +1,149 @@
+package cogito
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Pix4D/cogito/gitobj"
+)
+
+// TemplateData is the data available to the templates in the put params that support
+// Go text/template expansion, such as chat_message and chat_message_file.
+//
+// Example: "{{emoji .State}} {{.BuildJobName}} {{.ShortGitRef}}: {{.Vars.reason}}"
+type TemplateData struct {
+	Environment // The Concourse build metadata, such as BuildJobName.
+
+	State       BuildState
+	GitRef      string // Empty if Cogito is configured as chat only.
+	ShortGitRef string
+	Owner       string
+	Repo        string
+	BuildURL    string
+	// Fields of the commit, empty if not available.
+	CommitAuthor      string // Name of the author.
+	CommitAuthorEmail string
+	CommitCommitter   string // Name of the committer.
+	CommitSubject     string
+	CommitBody        string
+	CommitParents     []string // SHAs of the parents; more than one for a merge.
+	// Fields of the build read from the Concourse API, empty if source.concourse_token
+	// is not set. If available, the API also fills BuildCreatedBy for non-manual builds.
+	BuildStartTime time.Time
+	BuildDuration  time.Duration // Elapsed time from BuildStartTime to the put step.
+	FailedStep     string        // Name of the first failed step, such as a task.
+	FailedStepType string        // One of: task, get, put, ...
+	FailedStepLog  string        // Tail of the output of FailedStep, see source.chat_log_lines.
+	// The state of the previous build and the transition, empty if not available.
+	// Available only to the chat templates, see source.chat_notify_on_transitions.
+	PreviousState BuildState
+	Transition    Transition
+	// Custom variables, from put param vars.
+	Vars map[string]string
+}
+
+// newTemplateData returns the [TemplateData] for request, gitRef, commit and build.
+// Commit and build can be nil.
+func newTemplateData(request PutRequest, gitRef string, commit *gitobj.Commit,
+	build *ConcourseBuild,
+) TemplateData {
+	data := TemplateData{
+		Environment: request.Env,
+		State:       request.Params.State,
+		GitRef:      gitRef,
+		ShortGitRef: shortGitRef(gitRef),
+		Owner:       request.Source.Owner,
+		Repo:        request.Source.Repo,
+		BuildURL:    concourseBuildURL(request.Env),
+		Vars:        request.Params.Vars,
+	}
+	if commit != nil {
+		data.CommitAuthor = commit.Author.Name
+		data.CommitAuthorEmail = commit.Author.Email
+		data.CommitCommitter = commit.Committer.Name
+		data.CommitSubject = commit.Subject
+		data.CommitBody = commit.Body
+		data.CommitParents = commit.Parents
+	}
+	if build != nil {
+		data.BuildStartTime = build.StartTime
+		data.BuildDuration = build.Duration
+		data.FailedStep = build.FailedStep
+		data.FailedStepType = build.FailedStepType
+		data.FailedStepLog = strings.Join(build.FailedStepLog, "\n")
+		if build.CreatedBy != "" {
+			data.BuildCreatedBy = build.CreatedBy
+		}
+	}
+	return data
+}
+
+// templateFuncs are the helper functions available to the templates, in addition to the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	"upper":    func(v any) string { return strings.ToUpper(fmt.Sprint(v)) },
+	"lower":    func(v any) string { return strings.ToLower(fmt.Sprint(v)) },
+	"truncate": truncate,
+	"emoji":    stateIcon,
+	// The current UTC time in the given layout, for example {{date "2006-01-02"}}.
+	"date": func(layout string) string { return time.Now().UTC().Format(layout) },
+}
+
+// parseTemplate parses text as a template called name. The name appears in the error
+// messages, together with the line number.
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Funcs(templateFuncs).
+		Option("missingkey=error").
+		Parse(text)
+}
+
+// expandTemplate parses text as a template called name and executes it with data.
+func expandTemplate(name, text string, data TemplateData) (string, error) {
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var bld strings.Builder
+	if err := tmpl.Execute(&bld, data); err != nil {
+		return "", err
+	}
+	return bld.String(), nil
+}
+
+// expandTemplateOrText is like [expandTemplate], but if text is not a valid template or
+// cannot be executed with data, it logs a warning and returns text unchanged. The texts
+// of the put params are often written by a task and can contain anything: they must
+// not prevent sending the notification.
+func expandTemplateOrText(log *slog.Logger, name, text string, data TemplateData,
+) string {
+	expanded, err := expandTemplate(name, text, data)
+	if err != nil {
+		log.Warn("cannot expand template, using the text as-is", "error", err)
+		return text
+	}
+	return expanded
+}
+
+// truncate returns s truncated to at most n runes. If truncation happens, the last rune
+// is replaced by an ellipsis. The order of the arguments allows to use it in a pipeline:
+// {{.CommitSubject | truncate 20}}.
+func truncate(n int, s string) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// shortGitRef returns the abbreviated form of gitRef, as shown by the GitHub UI.
+func shortGitRef(gitRef string) string {
+	return gitRef[:min(len(gitRef), 7)]
+}
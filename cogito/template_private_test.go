@@ -0,0 +1,134 @@
+package cogito
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/gitobj"
+)
+
+func TestExpandTemplateSuccess(t *testing.T) {
+	type testCase struct {
+		name string
+		text string
+		want string
+	}
+
+	data := newTemplateData(
+		PutRequest{
+			Source: Source{Owner: "the-owner", Repo: "the-repo"},
+			Params: PutParams{
+				State: StateFailure,
+				Vars:  map[string]string{"reason": "flaky test"},
+			},
+			Env: Environment{BuildJobName: "the-job", BuildName: "42"},
+		},
+		"af6cd86e98eb1485f04d38b78d9532e916bbff02",
+		&gitobj.Commit{
+			Author:  gitobj.Signature{Name: "Ada Lovelace", Email: "ada@example.com"},
+			Subject: "Spell out 200",
+			Parents: []string{"03da27bce541a76847e3ba9796b6fb9dfb43cac5"},
+		},
+		&ConcourseBuild{
+			Duration:       83 * time.Second,
+			CreatedBy:      "ada",
+			FailedStep:     "unit-tests",
+			FailedStepType: "task",
+		})
+
+	test := func(t *testing.T, tc testCase) {
+		have, err := expandTemplate("the-name", tc.text, data)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "no template actions",
+			text: "hello",
+			want: "hello",
+		},
+		{
+			name: "environment and git ref",
+			text: "{{.BuildJobName}}/{{.BuildName}} {{.Owner}}/{{.Repo}}@{{.ShortGitRef}}",
+			want: "the-job/42 the-owner/the-repo@af6cd86",
+		},
+		{
+			name: "helpers",
+			text: "{{emoji .State}} {{.State | upper}} {{.Vars.reason | truncate 6}}",
+			want: "🔴 FAILURE flaky…",
+		},
+		{
+			name: "commit",
+			text: "{{.CommitSubject}} ({{.CommitAuthor}}, {{len .CommitParents}} parent)",
+			want: "Spell out 200 (Ada Lovelace, 1 parent)",
+		},
+		{
+			name: "concourse build",
+			text: "{{.FailedStepType}} {{.FailedStep}} failed after {{.BuildDuration}} ({{.BuildCreatedBy}})",
+			want: "task unit-tests failed after 1m23s (ada)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestExpandTemplateFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		text    string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := expandTemplate("the-name", tc.text, TemplateData{})
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "parse error reports the line number",
+			text:    "line 1\nline 2 {{.State",
+			wantErr: `template: the-name:2: unclosed action`,
+		},
+		{
+			name:    "unknown function",
+			text:    "{{pizza .State}}",
+			wantErr: `template: the-name:1: function "pizza" not defined`,
+		},
+		{
+			name:    "missing var",
+			text:    "{{.Vars.pizza}}",
+			wantErr: `template: the-name:1:7: executing "the-name" at <.Vars.pizza>: map has no entry for key "pizza"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	type testCase struct {
+		n    int
+		s    string
+		want string
+	}
+
+	testCases := []testCase{
+		{n: 5, s: "hello", want: "hello"},
+		{n: 4, s: "hello", want: "hel…"},
+		{n: 2, s: "🟢🟢🟢", want: "🟢…"},
+		{n: 0, s: "hello", want: ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, truncate(tc.n, tc.s), tc.want)
+	}
+}
@@ -0,0 +1,141 @@
+package cogito
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Transition is a pseudo-enum representing the valid values of
+// Source.ChatNotifyOnTransitions: a change of the build state with respect to the
+// previous build.
+type Transition string
+
+// NOTE: this list must be kept in sync with the custom JSON methods of [Transition].
+const (
+	TransitionBroken       Transition = "broken"        // From success to failing.
+	TransitionFixed        Transition = "fixed"         // From failing to success.
+	TransitionStillFailing Transition = "still_failing" // From failing to failing.
+)
+
+func (tr *Transition) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	*tr = Transition(str)
+
+	switch *tr {
+	case TransitionBroken, TransitionFixed, TransitionStillFailing:
+		return nil
+	default:
+		return fmt.Errorf("invalid transition: %s", str)
+	}
+}
+
+func (tr Transition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(tr))
+}
+
+// StateChange is the state of the previous build and the resulting [Transition].
+type StateChange struct {
+	Previous   BuildState
+	Transition Transition // Empty if there is no transition, see [stateTransition].
+}
+
+// String renders StateChange for the chat message, for example "fixed, was failure".
+func (sc StateChange) String() string {
+	switch sc.Transition {
+	case TransitionBroken, TransitionFixed:
+		return fmt.Sprintf("%s, was %s", sc.Transition, sc.Previous)
+	case TransitionStillFailing:
+		return "still failing"
+	default:
+		return ""
+	}
+}
+
+// stateTransition returns the transition from state previous to state current, or the
+// empty string if there is none. Abort and pending are neither failing nor success,
+// so they never cause a transition.
+func stateTransition(previous, current BuildState) Transition {
+	switch {
+	case previous == StateSuccess && isFailing(current):
+		return TransitionBroken
+	case isFailing(previous) && current == StateSuccess:
+		return TransitionFixed
+	case isFailing(previous) && isFailing(current):
+		return TransitionStillFailing
+	default:
+		return ""
+	}
+}
+
+// isFailing returns true if state is a failure of the build.
+func isFailing(state BuildState) bool {
+	return state == StateFailure || state == StateError
+}
+
+// ghPreviousState returns the state of the previous build for the same branch, read
+// from the commit statuses that request posts on source.owner/repo, on the commit
+// parent. With put param statuses, it combines the states of their contexts, as
+// [ghPostedState] does for the current build. It returns the empty string if the
+// parent has no status for one of the contexts.
+func ghPreviousState(log *slog.Logger, request PutRequest, parent string,
+) (BuildState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	gh, err := newGhClient(ctx, log, request.Source)
+	if err != nil {
+		return "", err
+	}
+	_, statuses, err := gh.CommitStatuses(ctx, parent, false)
+	if err != nil {
+		return "", err
+	}
+	var states []BuildState
+	for _, req := range ghStatusRequests(request) {
+		context := ghMakeContext(req)
+		i := slices.IndexFunc(statuses, func(st ContextStatus) bool {
+			return st.Context == context
+		})
+		if i < 0 {
+			return "", nil
+		}
+		// The GitHub states are a subset of the build states.
+		states = append(states, BuildState(statuses[i].State))
+	}
+	return combinedState(states), nil
+}
+
+// ghPostedState returns the state of the current build as seen by the commit statuses
+// that request posts on source.owner/repo: params.state, or the combination of the
+// states of put param statuses.
+func ghPostedState(request PutRequest) BuildState {
+	requests := ghStatusRequests(request)
+	states := make([]BuildState, 0, len(requests))
+	for _, req := range requests {
+		states = append(states, req.Params.State)
+	}
+	return combinedState(states)
+}
+
+// combinedState returns the first failing state of states, if any, otherwise the first
+// state that is not success, otherwise success.
+func combinedState(states []BuildState) BuildState {
+	combined := StateSuccess
+	for _, state := range states {
+		if isFailing(state) {
+			return state
+		}
+		if combined == StateSuccess {
+			combined = state
+		}
+	}
+	return combined
+}
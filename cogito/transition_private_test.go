@@ -0,0 +1,189 @@
+package cogito
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/testhelp"
+)
+
+func TestStateTransition(t *testing.T) {
+	type testCase struct {
+		previous BuildState
+		current  BuildState
+		want     Transition
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Equal(t, stateTransition(tc.previous, tc.current), tc.want)
+	}
+
+	testCases := []testCase{
+		{previous: StateSuccess, current: StateFailure, want: TransitionBroken},
+		{previous: StateSuccess, current: StateError, want: TransitionBroken},
+		{previous: StateFailure, current: StateSuccess, want: TransitionFixed},
+		{previous: StateError, current: StateSuccess, want: TransitionFixed},
+		{previous: StateFailure, current: StateError, want: TransitionStillFailing},
+		{previous: StateSuccess, current: StateSuccess, want: ""},
+		{previous: StateAbort, current: StateFailure, want: ""},
+		{previous: StateFailure, current: StateAbort, want: ""},
+		{previous: StatePending, current: StateSuccess, want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s to %s", tc.previous, tc.current),
+			func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestStateChangeString(t *testing.T) {
+	type testCase struct {
+		change StateChange
+		want   string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		assert.Equal(t, tc.change.String(), tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			change: StateChange{Previous: StateFailure, Transition: TransitionFixed},
+			want:   "fixed, was failure",
+		},
+		{
+			change: StateChange{Previous: StateSuccess, Transition: TransitionBroken},
+			want:   "broken, was success",
+		},
+		{
+			change: StateChange{Previous: StateError, Transition: TransitionStillFailing},
+			want:   "still failing",
+		},
+		{
+			change: StateChange{Previous: StateSuccess},
+			want:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGhPreviousState(t *testing.T) {
+	type testCase struct {
+		name     string
+		context  string
+		statuses []StatusParams
+		want     BuildState
+	}
+
+	const parent = "03da27bce541a76847e3ba9796b6fb9dfb43cac5"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/the-owner/the-repo/commits/"+parent+"/status" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, `{"message": "Not Found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"sha": %q, "statuses": [
+  {"context": "the-job", "state": "failure"},
+  {"context": "lint", "state": "success"},
+  {"context": "unit", "state": "success"}
+]}`, parent)
+	}))
+	t.Cleanup(ts.Close)
+
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{
+			Source: Source{
+				Owner:       "the-owner",
+				Repo:        "the-repo",
+				AccessToken: "the-token",
+				GhHostname:  strings.TrimPrefix(ts.URL, "http://"),
+			},
+			Params: PutParams{State: StateSuccess, Context: tc.context,
+				Statuses: tc.statuses},
+			Env: Environment{BuildJobName: "the-job"},
+		}
+
+		have, err := ghPreviousState(testhelp.MakeTestLog(), request, parent)
+
+		assert.NilError(t, err)
+		assert.Equal(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{name: "default context", want: StateFailure},
+		{name: "explicit context", context: "lint", want: StateSuccess},
+		{name: "no status for context", context: "e2e", want: ""},
+		{
+			name:     "statuses, one failed",
+			statuses: []StatusParams{{Context: "lint"}, {Context: "the-job"}},
+			want:     StateFailure,
+		},
+		{
+			name:     "statuses, all succeeded",
+			statuses: []StatusParams{{Context: "lint"}, {Context: "unit"}},
+			want:     StateSuccess,
+		},
+		{
+			name:     "statuses, no status for one context",
+			statuses: []StatusParams{{Context: "lint"}, {Context: "e2e"}},
+			want:     "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestGhPostedState(t *testing.T) {
+	type testCase struct {
+		name     string
+		state    BuildState
+		statuses []StatusParams
+		want     BuildState
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		request := PutRequest{
+			Params: PutParams{State: tc.state, Statuses: tc.statuses},
+		}
+
+		assert.Equal(t, ghPostedState(request), tc.want)
+	}
+
+	testCases := []testCase{
+		{name: "no statuses", state: StateError, want: StateError},
+		{
+			name:     "statuses inherit the state",
+			state:    StateSuccess,
+			statuses: []StatusParams{{Context: "lint"}, {Context: "unit"}},
+			want:     StateSuccess,
+		},
+		{
+			name:  "one status failed",
+			state: StateSuccess,
+			statuses: []StatusParams{{Context: "lint", State: StateFailure},
+				{Context: "unit"}},
+			want: StateFailure,
+		},
+		{
+			name:  "one status pending",
+			state: StateSuccess,
+			statuses: []StatusParams{{Context: "lint"},
+				{Context: "unit", State: StatePending}},
+			want: StatePending,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,133 @@
+package gitobj
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit is a parsed git commit object.
+type Commit struct {
+	Name      string // The object name (SHA) of the commit.
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	// Subject is the first paragraph of the message, joined in a single line, as
+	// shown by `git log --format=%s`.
+	Subject string
+	// Body is the rest of the message, without leading and trailing blank lines.
+	Body string
+}
+
+// Signature identifies the author or the committer of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// String returns the signature as shown by git: "Name <email>".
+func (sig Signature) String() string {
+	return fmt.Sprintf("%s <%s>", sig.Name, sig.Email)
+}
+
+// ReadCommit returns the commit with the given name.
+func (r *Reader) ReadCommit(name string) (Commit, error) {
+	obj, err := r.ReadObject(name)
+	if err != nil {
+		return Commit{}, err
+	}
+	if obj.Type != TypeCommit {
+		return Commit{}, fmt.Errorf("object %s: have type %s, want %s",
+			name, obj.Type, TypeCommit)
+	}
+	commit, err := ParseCommit(obj.Data)
+	if err != nil {
+		return Commit{}, fmt.Errorf("commit %s: %w", name, err)
+	}
+	commit.Name = name
+	return commit, nil
+}
+
+// ParseCommit parses the data of a commit object.
+//
+// The data is a list of headers, one per line, followed by an empty line and the
+// message. A header value can continue on the following lines, each starting with a
+// space (for example, gpgsig). Unknown headers are ignored.
+func ParseCommit(data []byte) (Commit, error) {
+	var commit Commit
+	headers, message, _ := strings.Cut(string(data), "\n\n")
+
+	for line := range strings.SplitSeq(headers, "\n") {
+		if strings.HasPrefix(line, " ") {
+			continue // Continuation of the previous header.
+		}
+		key, value, _ := strings.Cut(line, " ")
+		var err error
+		switch key {
+		case "tree":
+			commit.Tree = value
+		case "parent":
+			commit.Parents = append(commit.Parents, value)
+		case "author":
+			commit.Author, err = parseSignature(value)
+		case "committer":
+			commit.Committer, err = parseSignature(value)
+		}
+		if err != nil {
+			return Commit{}, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if commit.Tree == "" {
+		return Commit{}, fmt.Errorf("missing header: tree")
+	}
+
+	message = strings.TrimLeft(message, "\n")
+	subject, body, _ := strings.Cut(message, "\n\n")
+	commit.Subject = strings.Join(strings.Fields(subject), " ")
+	commit.Body = strings.Trim(body, "\n")
+
+	return commit, nil
+}
+
+// parseSignature parses a signature of the form:
+//
+//	Ada Lovelace <ada@example.com> 1704186000 +0100
+func parseSignature(value string) (Signature, error) {
+	open := strings.Index(value, "<")
+	closing := strings.LastIndex(value, ">")
+	if open < 0 || closing < open {
+		return Signature{}, fmt.Errorf("invalid signature: %q", value)
+	}
+	sig := Signature{
+		Name:  strings.TrimSpace(value[:open]),
+		Email: value[open+1 : closing],
+	}
+
+	fields := strings.Fields(value[closing+1:])
+	if len(fields) != 2 {
+		return Signature{}, fmt.Errorf("invalid signature date: %q", value)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid signature date: %q", value)
+	}
+	tz := fields[1]
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return Signature{}, fmt.Errorf("invalid signature timezone: %q", value)
+	}
+	hours, err1 := strconv.Atoi(tz[1:3])
+	minutes, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return Signature{}, fmt.Errorf("invalid signature timezone: %q", value)
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	sig.When = time.Unix(seconds, 0).In(time.FixedZone(tz, offset))
+
+	return sig, nil
+}
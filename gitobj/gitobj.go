@@ -0,0 +1,191 @@
+// Package gitobj reads objects, such as commits, from the object database of a git
+// repository, without depending on the git executable.
+//
+// It supports loose objects and packfiles with index version 2, including delta
+// objects (both offset and reference deltas). It supports only SHA-1 repositories.
+// It is meant to read a few objects, not to be fast.
+//
+// See https://git-scm.com/docs/gitformat-pack
+package gitobj
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ObjectType is the type of a git object.
+type ObjectType string
+
+const (
+	TypeCommit ObjectType = "commit"
+	TypeTree   ObjectType = "tree"
+	TypeBlob   ObjectType = "blob"
+	TypeTag    ObjectType = "tag"
+)
+
+// ErrNotFound is returned when an object is neither loose nor in any pack.
+var ErrNotFound = errors.New("object not found")
+
+// Object is a git object, with its contents uncompressed.
+type Object struct {
+	Type ObjectType
+	Data []byte
+}
+
+// Reader reads objects from the object database of a git repository.
+// A Reader is not safe for concurrent use.
+type Reader struct {
+	objectsDir string
+	packs      []*pack // Loaded on first use.
+	packsErr   error
+	loaded     bool
+}
+
+// NewReader returns a Reader for the object database objectsDir, usually
+// <repo>/.git/objects.
+func NewReader(objectsDir string) *Reader {
+	return &Reader{objectsDir: objectsDir}
+}
+
+// Close releases the resources held by the Reader.
+func (r *Reader) Close() error {
+	var errs []error
+	for _, p := range r.packs {
+		errs = append(errs, p.close())
+	}
+	r.packs = nil
+	r.loaded = false
+	return errors.Join(errs...)
+}
+
+// ReadObject returns the object with the given name (the hex SHA), looking first for
+// a loose object and then in the packs.
+func (r *Reader) ReadObject(name string) (Object, error) {
+	return r.readObject(name, 0)
+}
+
+// readObject is ReadObject for the base of a delta at depth in a delta chain, which can
+// span more than one pack.
+func (r *Reader) readObject(name string, depth int) (Object, error) {
+	if !isObjectName(name) {
+		return Object{}, fmt.Errorf("invalid object name: %q", name)
+	}
+
+	obj, err := r.readLoose(name)
+	if err == nil {
+		return obj, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return Object{}, err
+	}
+
+	if err := r.loadPacks(); err != nil {
+		return Object{}, err
+	}
+	for _, p := range r.packs {
+		offset, found := p.idx.lookup(name)
+		if !found {
+			continue
+		}
+		obj, err := p.readAt(r, offset, depth)
+		if err != nil {
+			if depth > 0 {
+				// Avoid repeating the names of a long chain in the error.
+				return Object{}, err
+			}
+			return Object{}, fmt.Errorf("object %s: %w", name, err)
+		}
+		return obj, nil
+	}
+
+	return Object{}, fmt.Errorf("object %s: %w", name, ErrNotFound)
+}
+
+// readLoose reads the loose object name. If the object does not exist, the returned
+// error wraps fs.ErrNotExist.
+//
+// A loose object is stored zlib-compressed in file objects/<2 hex>/<38 hex>, with
+// contents "<type> <size>\x00<data>".
+func (r *Reader) readLoose(name string) (Object, error) {
+	file, err := os.Open(filepath.Join(r.objectsDir, name[:2], name[2:]))
+	if err != nil {
+		return Object{}, err
+	}
+	defer file.Close()
+
+	zr, err := zlib.NewReader(file)
+	if err != nil {
+		return Object{}, fmt.Errorf("loose object %s: %w", name, err)
+	}
+	defer zr.Close()
+	buf, err := io.ReadAll(zr)
+	if err != nil {
+		return Object{}, fmt.Errorf("loose object %s: %w", name, err)
+	}
+
+	header, data, found := bytes.Cut(buf, []byte{0})
+	if !found {
+		return Object{}, fmt.Errorf("loose object %s: missing header", name)
+	}
+	typ, sizeStr, found := strings.Cut(string(header), " ")
+	if !found {
+		return Object{}, fmt.Errorf("loose object %s: invalid header: %q", name, header)
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil || size != len(data) {
+		return Object{}, fmt.Errorf("loose object %s: invalid size: have %d, header: %q",
+			name, len(data), header)
+	}
+	objType := ObjectType(typ)
+	switch objType {
+	case TypeCommit, TypeTree, TypeBlob, TypeTag:
+	default:
+		return Object{}, fmt.Errorf("loose object %s: invalid type: %q", name, typ)
+	}
+
+	return Object{Type: objType, Data: data}, nil
+}
+
+// loadPacks opens all the packs in objects/pack, once.
+func (r *Reader) loadPacks() error {
+	if r.loaded {
+		return r.packsErr
+	}
+	r.loaded = true
+
+	idxPaths, err := filepath.Glob(filepath.Join(r.objectsDir, "pack", "*.idx"))
+	if err != nil {
+		r.packsErr = err
+		return err
+	}
+	for _, idxPath := range idxPaths {
+		p, err := openPack(idxPath)
+		if err != nil {
+			r.packsErr = err
+			return err
+		}
+		r.packs = append(r.packs, p)
+	}
+	return nil
+}
+
+// isObjectName reports whether name is a full SHA-1 object name, in lowercase hex.
+func isObjectName(name string) bool {
+	if len(name) != 40 {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
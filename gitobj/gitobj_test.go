@@ -0,0 +1,301 @@
+package gitobj_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/Pix4D/cogito/gitobj"
+)
+
+// The fixtures are generated by testdata/make-fixtures.sh. Both contain the same
+// objects:
+// - ofs-delta: the last commit is loose, the others are in a pack with offset deltas.
+// - ref-delta: all the objects are in a pack with reference deltas.
+var fixtures = []string{"testdata/ofs-delta/objects", "testdata/ref-delta/objects"}
+
+const (
+	initialSHA = "c27e5b3f5c9b0c366ef8cb5a7692facb5529a438"
+	featureSHA = "23852f9351465de236d70ab783cc7b897d5ebd9b"
+	helloSHA   = "f78964472187dd19f9b1df7ab42670b501a19913"
+	mergeSHA   = "03da27bce541a76847e3ba9796b6fb9dfb43cac5"
+	lastSHA    = "adba0ed0cf1f5d2b326081e50bd490322295a6ea"
+)
+
+func TestReadCommitSuccess(t *testing.T) {
+	type testCase struct {
+		name string
+		sha  string
+		want gitobj.Commit
+	}
+
+	cet := time.FixedZone("+0100", 3600)
+	est := time.FixedZone("-0500", -5*3600)
+
+	test := func(t *testing.T, objectsDir string, tc testCase) {
+		reader := gitobj.NewReader(objectsDir)
+		defer reader.Close()
+
+		have, err := reader.ReadCommit(tc.sha)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, tc.want)
+	}
+
+	testCases := []testCase{
+		{
+			name: "root commit",
+			sha:  initialSHA,
+			want: gitobj.Commit{
+				Name: initialSHA,
+				Tree: "d9943211a6ddb54359d5d7669c83c743bed8d76c",
+				Author: gitobj.Signature{
+					Name:  "Ada Lovelace",
+					Email: "ada@example.com",
+					When:  time.Date(2024, 1, 2, 10, 0, 0, 0, cet),
+				},
+				Committer: gitobj.Signature{
+					Name:  "Charles Babbage",
+					Email: "charles@example.com",
+					When:  time.Date(2024, 1, 2, 10, 0, 0, 0, cet),
+				},
+				Subject: "Initial commit",
+			},
+		},
+		{
+			name: "commit with body",
+			sha:  featureSHA,
+			want: gitobj.Commit{
+				Name:    featureSHA,
+				Tree:    "24d9dab69affd2127ac4a1c78f30873d78c62e19",
+				Parents: []string{initialSHA},
+				Author: gitobj.Signature{
+					Name:  "Ada Lovelace",
+					Email: "ada@example.com",
+					When:  time.Date(2024, 1, 3, 11, 0, 0, 0, cet),
+				},
+				Committer: gitobj.Signature{
+					Name:  "Charles Babbage",
+					Email: "charles@example.com",
+					When:  time.Date(2024, 1, 3, 11, 0, 0, 0, cet),
+				},
+				Subject: "Spell out 150",
+				Body:    "The body of the commit.\n\nIt has multiple paragraphs.",
+			},
+		},
+		{
+			name: "merge commit",
+			sha:  mergeSHA,
+			want: gitobj.Commit{
+				Name:    mergeSHA,
+				Tree:    "714fdfae4be1aa19bc4cf867234622f03fab75cc",
+				Parents: []string{helloSHA, featureSHA},
+				Author: gitobj.Signature{
+					Name:  "Ada Lovelace",
+					Email: "ada@example.com",
+					When:  time.Date(2024, 1, 5, 13, 0, 0, 0, cet),
+				},
+				Committer: gitobj.Signature{
+					Name:  "Charles Babbage",
+					Email: "charles@example.com",
+					When:  time.Date(2024, 1, 5, 13, 0, 0, 0, cet),
+				},
+				Subject: "Merge branch 'feature'",
+			},
+		},
+		{
+			name: "negative timezone",
+			sha:  lastSHA,
+			want: gitobj.Commit{
+				Name:    lastSHA,
+				Tree:    "fdfecef5e1d0ac13d26ff4564f3cc77a2bd878c1",
+				Parents: []string{mergeSHA},
+				Author: gitobj.Signature{
+					Name:  "Ada Lovelace",
+					Email: "ada@example.com",
+					When:  time.Date(2024, 1, 6, 14, 0, 0, 0, est),
+				},
+				Committer: gitobj.Signature{
+					Name:  "Charles Babbage",
+					Email: "charles@example.com",
+					When:  time.Date(2024, 1, 6, 14, 0, 0, 0, est),
+				},
+				Subject: "Spell out 200",
+			},
+		},
+	}
+
+	for _, objectsDir := range fixtures {
+		for _, tc := range testCases {
+			name := fmt.Sprintf("%s: %s", filepath.Base(filepath.Dir(objectsDir)), tc.name)
+			t.Run(name, func(t *testing.T) { test(t, objectsDir, tc) })
+		}
+	}
+}
+
+func TestReadCommitAllFixtureCommits(t *testing.T) {
+	for _, objectsDir := range fixtures {
+		t.Run(filepath.Base(filepath.Dir(objectsDir)), func(t *testing.T) {
+			buf, err := os.ReadFile(filepath.Join(filepath.Dir(objectsDir), "commits.txt"))
+			assert.NilError(t, err)
+			reader := gitobj.NewReader(objectsDir)
+			defer reader.Close()
+
+			for line := range strings.Lines(string(buf)) {
+				sha, wantSubject, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+				commit, err := reader.ReadCommit(sha)
+
+				assert.NilError(t, err)
+				assert.Equal(t, commit.Subject, wantSubject)
+			}
+		})
+	}
+}
+
+func TestReadObjectDeltaBlob(t *testing.T) {
+	var bld strings.Builder
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&bld, "%d\n", i)
+	}
+	original := bld.String()
+	spelled := strings.Replace(original, "\n150\n", "\none hundred fifty\n", 1)
+
+	for _, objectsDir := range fixtures {
+		t.Run(filepath.Base(filepath.Dir(objectsDir)), func(t *testing.T) {
+			reader := gitobj.NewReader(objectsDir)
+			defer reader.Close()
+
+			obj, err := reader.ReadObject("e9f1816de795d8e46914856d53c0f1de4291ce89")
+			assert.NilError(t, err)
+			assert.Equal(t, obj.Type, gitobj.TypeBlob)
+			assert.Equal(t, string(obj.Data), original)
+
+			obj, err = reader.ReadObject("60be0c0cc0065622cec39817db468b51e8110b1d")
+			assert.NilError(t, err)
+			assert.Equal(t, obj.Type, gitobj.TypeBlob)
+			assert.Equal(t, string(obj.Data), spelled)
+		})
+	}
+}
+
+func TestReadObjectFailure(t *testing.T) {
+	type testCase struct {
+		name       string
+		objectsDir string
+		sha        string
+		wantErr    string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		reader := gitobj.NewReader(tc.objectsDir)
+		defer reader.Close()
+
+		_, err := reader.ReadCommit(tc.sha)
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:       "invalid name",
+			objectsDir: fixtures[0],
+			sha:        "banana",
+			wantErr:    `invalid object name: "banana"`,
+		},
+		{
+			name:       "not found",
+			objectsDir: fixtures[0],
+			sha:        "0123456789abcdef0123456789abcdef01234567",
+			wantErr:    "object 0123456789abcdef0123456789abcdef01234567: object not found",
+		},
+		{
+			name:       "missing objects dir",
+			objectsDir: "testdata/non-existing",
+			sha:        initialSHA,
+			wantErr:    "object c27e5b3f5c9b0c366ef8cb5a7692facb5529a438: object not found",
+		},
+		{
+			name:       "not a commit",
+			objectsDir: fixtures[0],
+			sha:        "ce013625030ba8dba906f756967f9e9ca394464a",
+			wantErr:    "object ce013625030ba8dba906f756967f9e9ca394464a: have type blob, want commit",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadObjectNotFoundIs(t *testing.T) {
+	reader := gitobj.NewReader(fixtures[1])
+	defer reader.Close()
+
+	_, err := reader.ReadObject("0123456789abcdef0123456789abcdef01234567")
+
+	assert.Assert(t, errors.Is(err, gitobj.ErrNotFound))
+}
+
+func TestParseCommitSuccess(t *testing.T) {
+	// In a multi-line header, an empty line is encoded as a single space.
+	data := "tree d9943211a6ddb54359d5d7669c83c743bed8d76c\n" +
+		"author Ada Lovelace <ada@example.com> 1704186000 +0100\n" +
+		"committer Charles Babbage <charles@example.com> 1704186000 +0100\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+		" \n" +
+		" iQIzBAABCAAdFiEE\n" +
+		" -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"A subject\non two lines\n\nThe body.\n"
+
+	have, err := gitobj.ParseCommit([]byte(data))
+
+	assert.NilError(t, err)
+	assert.Equal(t, have.Tree, "d9943211a6ddb54359d5d7669c83c743bed8d76c")
+	assert.Equal(t, have.Author.String(), "Ada Lovelace <ada@example.com>")
+	assert.Equal(t, have.Subject, "A subject on two lines")
+	assert.Equal(t, have.Body, "The body.")
+}
+
+func TestParseCommitFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		data    string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := gitobj.ParseCommit([]byte(tc.data))
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing tree",
+			data:    "author A <a@b> 1 +0000\n\nsubject\n",
+			wantErr: "missing header: tree",
+		},
+		{
+			name:    "invalid author",
+			data:    "tree abc\nauthor A a@b 1 +0000\n\nsubject\n",
+			wantErr: `author: invalid signature: "A a@b 1 +0000"`,
+		},
+		{
+			name:    "invalid timezone",
+			data:    "tree abc\ncommitter A <a@b> 1 CET\n\nsubject\n",
+			wantErr: `committer: invalid signature timezone: "A <a@b> 1 CET"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
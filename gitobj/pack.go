@@ -0,0 +1,373 @@
+package gitobj
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Object types as encoded in a pack.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// maxDeltaDepth bounds the length of a delta chain, to protect against corrupted packs.
+// Git uses a default depth of 50 and a maximum of 4095.
+const maxDeltaDepth = 4095
+
+// maxDeltaPrealloc bounds the memory allocated upfront for the result of a delta, since
+// the result size is read from the pack and could be corrupted. Bigger results are
+// still supported, by growing the buffer.
+const maxDeltaPrealloc = 1 << 20
+
+// pack is a packfile together with its index.
+type pack struct {
+	idx  packIndex
+	file *os.File
+	size int64
+}
+
+// openPack opens the pack corresponding to the index file at idxPath.
+func openPack(idxPath string) (*pack, error) {
+	buf, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, fmt.Errorf("pack index: %w", err)
+	}
+	idx, err := parsePackIndex(buf)
+	if err != nil {
+		return nil, fmt.Errorf("pack index %s: %w", idxPath, err)
+	}
+
+	packPath := strings.TrimSuffix(idxPath, ".idx") + ".pack"
+	file, err := os.Open(packPath)
+	if err != nil {
+		return nil, fmt.Errorf("pack: %w", err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("pack: %w", err)
+	}
+	var header [12]byte
+	if _, err := file.ReadAt(header[:], 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("pack %s: header: %w", packPath, err)
+	}
+	if string(header[:4]) != "PACK" {
+		file.Close()
+		return nil, fmt.Errorf("pack %s: invalid signature", packPath)
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		file.Close()
+		return nil, fmt.Errorf("pack %s: unsupported version %d", packPath, version)
+	}
+
+	return &pack{idx: idx, file: file, size: fi.Size()}, nil
+}
+
+func (p *pack) close() error {
+	return p.file.Close()
+}
+
+// readAt returns the object at offset in the pack, resolving deltas. A reference delta
+// can have its base in another pack, so readAt needs r.
+func (p *pack) readAt(r *Reader, offset int64, depth int) (Object, error) {
+	if depth > maxDeltaDepth {
+		return Object{}, fmt.Errorf("delta chain too long at offset %d", offset)
+	}
+	if offset < 12 || offset >= p.size {
+		return Object{}, fmt.Errorf("invalid offset %d", offset)
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(p.file, offset, p.size-offset))
+
+	// The object header is a variable-length integer: the first byte contains the type
+	// in bits 4-6 and the lowest 4 bits of the size; the following bytes contain 7 bits
+	// of the size each. The MSB is the continuation bit.
+	b, err := br.ReadByte()
+	if err != nil {
+		return Object{}, err
+	}
+	kind := (b >> 4) & 0x7
+	size := uint64(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = br.ReadByte(); err != nil {
+			return Object{}, err
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+
+	switch kind {
+	case packCommit, packTree, packBlob, packTag:
+		data, err := inflate(br, size)
+		if err != nil {
+			return Object{}, err
+		}
+		return Object{Type: packTypes[kind], Data: data}, nil
+
+	case packOfsDelta:
+		// The offset of the base, relative to this object, is encoded big-endian with
+		// an add-one quirk on every continuation byte.
+		b, err := br.ReadByte()
+		if err != nil {
+			return Object{}, err
+		}
+		rel := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = br.ReadByte(); err != nil {
+				return Object{}, err
+			}
+			rel = ((rel + 1) << 7) | int64(b&0x7f)
+		}
+		base, err := p.readAt(r, offset-rel, depth+1)
+		if err != nil {
+			return Object{}, err
+		}
+		return applyDeltaFrom(br, size, base)
+
+	case packRefDelta:
+		var baseName [20]byte
+		if _, err := io.ReadFull(br, baseName[:]); err != nil {
+			return Object{}, err
+		}
+		name := hex.EncodeToString(baseName[:])
+		var base Object
+		if baseOffset, found := p.idx.lookup(name); found {
+			base, err = p.readAt(r, baseOffset, depth+1)
+		} else {
+			// Keep counting the depth, since the chain can go back and forth
+			// between packs.
+			base, err = r.readObject(name, depth+1)
+		}
+		if err != nil {
+			if depth > 0 {
+				return Object{}, err
+			}
+			return Object{}, fmt.Errorf("delta base %s: %w", name, err)
+		}
+		return applyDeltaFrom(br, size, base)
+
+	default:
+		return Object{}, fmt.Errorf("invalid object type %d at offset %d", kind, offset)
+	}
+}
+
+var packTypes = map[byte]ObjectType{
+	packCommit: TypeCommit,
+	packTree:   TypeTree,
+	packBlob:   TypeBlob,
+	packTag:    TypeTag,
+}
+
+// applyDeltaFrom reads a compressed delta of size bytes from rd and applies it to base.
+func applyDeltaFrom(rd io.Reader, size uint64, base Object) (Object, error) {
+	delta, err := inflate(rd, size)
+	if err != nil {
+		return Object{}, err
+	}
+	data, err := applyDelta(base.Data, delta)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Type: base.Type, Data: data}, nil
+}
+
+// inflate decompresses from rd a zlib stream, that must expand to size bytes.
+func inflate(rd io.Reader, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(zr, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) != size {
+		return nil, fmt.Errorf("inflate: size mismatch: have %d, want %d", n, size)
+	}
+	return buf.Bytes(), nil
+}
+
+// applyDelta returns the result of applying delta to base.
+//
+// A delta is: the size of the base and the size of the result (both as little-endian
+// base-128 integers), followed by a sequence of instructions, either "copy from base"
+// (MSB set) or "insert the next n bytes of the delta" (MSB not set, n in the 7 bits).
+func applyDelta(base, delta []byte) ([]byte, error) {
+	rd := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, fmt.Errorf("delta: base size: %w", err)
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta: base size mismatch: have %d, want %d",
+			len(base), baseSize)
+	}
+	resultSize, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return nil, fmt.Errorf("delta: result size: %w", err)
+	}
+
+	result := make([]byte, 0, min(resultSize, maxDeltaPrealloc))
+	for rd.Len() > 0 {
+		op, _ := rd.ReadByte()
+		switch {
+		case op&0x80 != 0:
+			// Bits 0-3 tell which bytes of the offset are present, bits 4-6 tell which
+			// bytes of the size are present, little-endian.
+			var offset, size uint64
+			for i := range 7 {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				b, err := rd.ReadByte()
+				if err != nil {
+					return nil, errors.New("delta: truncated copy instruction")
+				}
+				if i < 4 {
+					offset |= uint64(b) << (8 * i)
+				} else {
+					size |= uint64(b) << (8 * (i - 4))
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, fmt.Errorf("delta: copy out of bounds: offset %d, size %d, base %d",
+					offset, size, len(base))
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			n := int(op)
+			if n > rd.Len() {
+				return nil, errors.New("delta: truncated insert instruction")
+			}
+			start := len(delta) - rd.Len()
+			result = append(result, delta[start:start+n]...)
+			if _, err := rd.Seek(int64(n), io.SeekCurrent); err != nil {
+				return nil, fmt.Errorf("delta: %w", err)
+			}
+		default:
+			return nil, errors.New("delta: reserved instruction 0")
+		}
+		// Stop early instead of growing the result beyond what the delta announces.
+		if uint64(len(result)) > resultSize {
+			return nil, fmt.Errorf("delta: result size mismatch: have more than %d",
+				resultSize)
+		}
+	}
+
+	if uint64(len(result)) != resultSize {
+		return nil, fmt.Errorf("delta: result size mismatch: have %d, want %d",
+			len(result), resultSize)
+	}
+	return result, nil
+}
+
+// packIndex is a pack index, version 2.
+//
+// Layout: magic "\377tOc", version, 256 fan-out entries (the number of objects whose
+// first byte is <= the entry index), the sorted object names, their CRC32, their
+// 4-byte offsets and, for offsets with the MSB set, an index in the table of 8-byte
+// offsets.
+type packIndex struct {
+	count        int
+	fanout       []byte
+	names        []byte
+	offsets      []byte
+	largeOffsets []byte
+}
+
+func parsePackIndex(buf []byte) (packIndex, error) {
+	const headerLen = 8
+	const fanoutLen = 256 * 4
+	if len(buf) < headerLen+fanoutLen || string(buf[:4]) != "\377tOc" {
+		return packIndex{}, errors.New("unsupported format (only version 2 is supported)")
+	}
+	if version := binary.BigEndian.Uint32(buf[4:8]); version != 2 {
+		return packIndex{}, fmt.Errorf("unsupported version %d", version)
+	}
+	fanout := buf[headerLen : headerLen+fanoutLen]
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	// The fan-out entries are cumulative counts: lookup relies on them to stay within
+	// the table of names.
+	prev := uint32(0)
+	for i := range 256 {
+		entry := binary.BigEndian.Uint32(fanout[i*4:])
+		if entry < prev {
+			return packIndex{}, fmt.Errorf("invalid fan-out entry %d: %d < %d",
+				i, entry, prev)
+		}
+		prev = entry
+	}
+
+	namesStart := headerLen + fanoutLen
+	offsetsStart := namesStart + count*20 + count*4 // skip the CRC32 table
+	largeStart := offsetsStart + count*4
+	// The index ends with the checksum of the pack and of the index itself.
+	if len(buf) < largeStart+2*20 {
+		return packIndex{}, errors.New("truncated")
+	}
+
+	return packIndex{
+		count:        count,
+		fanout:       fanout,
+		names:        buf[namesStart : namesStart+count*20],
+		offsets:      buf[offsetsStart:largeStart],
+		largeOffsets: buf[largeStart : len(buf)-2*20],
+	}, nil
+}
+
+// lookup returns the offset in the pack of the object name.
+func (idx packIndex) lookup(name string) (int64, bool) {
+	want, err := hex.DecodeString(name)
+	if err != nil || len(want) != 20 {
+		return 0, false
+	}
+
+	lo := 0
+	if want[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(idx.fanout[(int(want[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(idx.fanout[int(want[0])*4:]))
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		switch bytes.Compare(idx.names[mid*20:mid*20+20], want) {
+		case 0:
+			return idx.offset(mid)
+		case -1:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, false
+}
+
+// offset returns the offset in the pack of the i-th object of the index.
+func (idx packIndex) offset(i int) (int64, bool) {
+	off := binary.BigEndian.Uint32(idx.offsets[i*4:])
+	if off&0x80000000 == 0 {
+		return int64(off), true
+	}
+	j := int(off & 0x7fffffff)
+	if (j+1)*8 > len(idx.largeOffsets) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(idx.largeOffsets[j*8:])), true
+}
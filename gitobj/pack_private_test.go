@@ -0,0 +1,189 @@
+package gitobj
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestApplyDeltaSuccess(t *testing.T) {
+	base := []byte("hello, world")
+	delta := []byte{
+		12,             // base size
+		13,             // result size
+		0x80 | 0x10, 5, // copy 5 bytes from offset 0: "hello"
+		1, '!', // insert "!"
+		0x80 | 0x01 | 0x10, 5, 7, // copy 7 bytes from offset 5: ", world"
+	}
+
+	have, err := applyDelta(base, delta)
+
+	assert.NilError(t, err)
+	assert.Equal(t, string(have), "hello!, world")
+}
+
+func TestApplyDeltaFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		delta   []byte
+		wantErr string
+	}
+
+	base := []byte("hello")
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := applyDelta(base, tc.delta)
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "base size mismatch",
+			delta:   []byte{4, 1, 1, 'a'},
+			wantErr: "delta: base size mismatch: have 5, want 4",
+		},
+		{
+			name:    "copy out of bounds",
+			delta:   []byte{5, 6, 0x80 | 0x10, 6},
+			wantErr: "delta: copy out of bounds: offset 0, size 6, base 5",
+		},
+		{
+			name:    "truncated insert",
+			delta:   []byte{5, 3, 3, 'a'},
+			wantErr: "delta: truncated insert instruction",
+		},
+		{
+			name:    "reserved instruction",
+			delta:   []byte{5, 1, 0},
+			wantErr: "delta: reserved instruction 0",
+		},
+		{
+			name:    "result size mismatch",
+			delta:   []byte{5, 9, 1, 'a'},
+			wantErr: "delta: result size mismatch: have 1, want 9",
+		},
+		{
+			name:    "result bigger than announced",
+			delta:   []byte{5, 1, 0x80 | 0x10, 5},
+			wantErr: "delta: result size mismatch: have more than 1",
+		},
+		{
+			name: "corrupted result size",
+			// 2^62, as base-128: not allocated upfront.
+			delta:   []byte{5, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40, 1, 'a'},
+			wantErr: "delta: result size mismatch: have 1, want 4611686018427387904",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestParsePackIndexFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		fanout  func(fanout []byte)
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		buf := make([]byte, 8+256*4+2*20)
+		copy(buf, "\377tOc")
+		binary.BigEndian.PutUint32(buf[4:], 2)
+		tc.fanout(buf[8 : 8+256*4])
+
+		_, err := parsePackIndex(buf)
+
+		assert.Error(t, err, tc.wantErr)
+	}
+
+	testCases := []testCase{
+		{
+			name: "decreasing fan-out",
+			fanout: func(fanout []byte) {
+				binary.BigEndian.PutUint32(fanout[10*4:], 7)
+			},
+			wantErr: "invalid fan-out entry 11: 0 < 7",
+		},
+		{
+			name: "fan-out beyond the names",
+			fanout: func(fanout []byte) {
+				for i := range 256 {
+					binary.BigEndian.PutUint32(fanout[i*4:], 1)
+				}
+			},
+			wantErr: "truncated",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestReadObjectDeltaCycleAcrossPacks(t *testing.T) {
+	objectsDir := t.TempDir()
+	packDir := filepath.Join(objectsDir, "pack")
+	assert.NilError(t, os.Mkdir(packDir, 0o755))
+	nameA := strings.Repeat("a", 40)
+	nameB := strings.Repeat("b", 40)
+	// Each pack has a reference delta whose base is in the other pack.
+	writeRefDeltaPack(t, filepath.Join(packDir, "pack-a"), nameA, nameB)
+	writeRefDeltaPack(t, filepath.Join(packDir, "pack-b"), nameB, nameA)
+	reader := NewReader(objectsDir)
+	defer reader.Close()
+
+	_, err := reader.ReadObject(nameA)
+
+	assert.Error(t, err,
+		"object "+nameA+": delta base "+nameB+": delta chain too long at offset 12")
+}
+
+// writeRefDeltaPack writes files <path>.pack and <path>.idx, with the single object
+// name, a reference delta with base baseName.
+func writeRefDeltaPack(t *testing.T, path, name, baseName string) {
+	t.Helper()
+	delta := []byte{1, 1, 1, 'x'} // base size, result size, insert "x"
+
+	var pack bytes.Buffer
+	pack.WriteString("PACK")
+	pack.Write(binary.BigEndian.AppendUint32(nil, 2))
+	pack.Write(binary.BigEndian.AppendUint32(nil, 1))
+	pack.WriteByte(packRefDelta<<4 | byte(len(delta)))
+	base, err := hex.DecodeString(baseName)
+	assert.NilError(t, err)
+	pack.Write(base)
+	zw := zlib.NewWriter(&pack)
+	_, err = zw.Write(delta)
+	assert.NilError(t, err)
+	assert.NilError(t, zw.Close())
+	pack.Write(make([]byte, 20)) // checksum, not verified
+	assert.NilError(t, os.WriteFile(path+".pack", pack.Bytes(), 0o644))
+
+	sha, err := hex.DecodeString(name)
+	assert.NilError(t, err)
+	var idx bytes.Buffer
+	idx.WriteString("\377tOc")
+	idx.Write(binary.BigEndian.AppendUint32(nil, 2))
+	for i := range 256 {
+		var count uint32
+		if i >= int(sha[0]) {
+			count = 1
+		}
+		idx.Write(binary.BigEndian.AppendUint32(nil, count))
+	}
+	idx.Write(sha)
+	idx.Write(make([]byte, 4))                        // CRC32, not verified
+	idx.Write(binary.BigEndian.AppendUint32(nil, 12)) // offset, after the pack header
+	idx.Write(make([]byte, 2*20))                     // checksums, not verified
+	assert.NilError(t, os.WriteFile(path+".idx", idx.Bytes(), 0o644))
+}
@@ -0,0 +1,73 @@
+#! /bin/sh
+
+# Generates the git object fixtures used by the tests of package gitobj.
+# The dates and identities are fixed, so that the object names are reproducible.
+#
+# Usage: cd gitobj/testdata && ./make-fixtures.sh
+
+set -e
+
+export GIT_AUTHOR_NAME="Ada Lovelace"
+export GIT_AUTHOR_EMAIL="ada@example.com"
+export GIT_COMMITTER_NAME="Charles Babbage"
+export GIT_COMMITTER_EMAIL="charles@example.com"
+export GIT_CONFIG_GLOBAL=/dev/null
+export GIT_CONFIG_NOSYSTEM=1
+
+commit() {
+    export GIT_AUTHOR_DATE="$1"
+    export GIT_COMMITTER_DATE="$1"
+    shift
+    git commit --quiet "$@"
+}
+
+merge() {
+    export GIT_AUTHOR_DATE="$1"
+    export GIT_COMMITTER_DATE="$1"
+    shift
+    git merge --quiet "$@"
+}
+
+work=$(mktemp -d)
+trap 'rm -rf $work' EXIT
+
+git init --quiet --initial-branch=main "$work/repo"
+(
+    cd "$work/repo"
+    seq 1 300 > numbers.txt
+    git add numbers.txt
+    commit "2024-01-02T10:00:00+01:00" -m "Initial commit"
+
+    git switch --quiet -c feature
+    sed -i 's/^150$/one hundred fifty/' numbers.txt
+    commit "2024-01-03T11:00:00+01:00" -a -m "Spell out 150" -m "The body of the commit.
+
+It has multiple paragraphs."
+
+    git switch --quiet main
+    echo "hello" > hello.txt
+    git add hello.txt
+    commit "2024-01-04T12:00:00+01:00" -m "Add hello"
+    merge "2024-01-05T13:00:00+01:00" --no-ff -m "Merge branch 'feature'" feature
+
+    # Pack all the objects so far, using offset deltas.
+    git gc --quiet --aggressive
+
+    # Leave the last commit as loose objects.
+    sed -i 's/^200$/two hundred/' numbers.txt
+    commit "2024-01-06T14:00:00-05:00" -a -m "Spell out 200"
+)
+rm -rf ofs-delta
+mkdir ofs-delta
+cp -r "$work/repo/.git/objects" ofs-delta/objects
+rm -rf ofs-delta/objects/info
+git -C "$work/repo" log --format='%H %s' > ofs-delta/commits.txt
+
+# Same objects, all packed, using reference deltas.
+git clone --quiet --bare "$work/repo" "$work/ref.git"
+git -C "$work/ref.git" -c repack.useDeltaBaseOffset=false repack --quiet -a -d -f
+rm -rf ref-delta
+mkdir ref-delta
+cp -r "$work/ref.git/objects" ref-delta/objects
+rm -rf ref-delta/objects/info ref-delta/objects/pack/*.bitmap
+git -C "$work/ref.git" log --format='%H %s' > ref-delta/commits.txt
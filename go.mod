@@ -7,6 +7,7 @@ require (
 	github.com/Pix4D/go-kit v0.4.0
 	github.com/alexflint/go-arg v1.4.3
 	github.com/sasbury/mini v0.0.0-20181226232755-dc74af49394b
+	gopkg.in/yaml.v3 v3.0.1
 	gotest.tools/v3 v3.5.1
 )
 
@@ -38,7 +38,8 @@ func IdentityRenamer(name string) string {
 // CopyDir recursively copies src directory below dst directory, with optional
 // transformations.
 // It performs the following transformations:
-//   - Renames any directory with renamer.
+//   - Renames any directory and any file with renamer. This allows to have a ".git"
+//     file, as used by git worktrees and submodules.
 //   - If templatedata is not empty, will consider each file ending with ".template" as a Go
 //     template.
 //   - If a file name contains basic Go template formatting (eg: `foo-{{.bar}}.template`), the
@@ -104,6 +105,7 @@ func CopyDir(dst string, src string, dirRenamer Renamer, templatedata TemplateDa
 				}
 				name = buf.String()
 			}
+			name = dirRenamer(name)
 			if err := copyFile(filepath.Join(tgtDir, name), src, templatedata); err != nil {
 				return err
 			}